@@ -0,0 +1,381 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Template variables are the JSON names of the AccessLog fields, "params.<name>", "headers.<name>" and
+// "extra.<name>", and the derived time_local (Apache format), time_iso8601 and latency_ms.
+const (
+	CombinedLogFormat = `${remote_ip} - ${userId} [${time_local}] "${method} ${uri} ${proto}" ${status} ${bytes_sent} "${referer}" "${user_agent}"`
+
+	LTSVLogFormat = "time:${time_local}\thost:${remote_ip}\tuser:${userId}\tmethod:${method}\turi:${uri}\tprotocol:${proto}" +
+		"\tstatus:${status}\tsize:${bytes_sent}\treqsize:${request_length}\treferer:${referer}\tua:${user_agent}" +
+		"\tvhost:${host}\treqtime:${latency}\treqid:${request_id}\tcontroller:${controller}\taction:${action}\terror:${error}"
+
+	LogfmtLogFormat = "time=${time_iso8601} request_id=${request_id} remote_ip=${remote_ip} method=${method} uri=${uri}" +
+		" status=${status} latency=${latency} bytes_in=${request_length} bytes_out=${bytes_sent}" +
+		" controller=${controller} action=${action} user_id=${userId} error=${error}"
+)
+
+type AccessLogFormatter interface {
+	Format(accessLog *AccessLog) []byte
+}
+
+type AccessLogFormatterFunc func(accessLog *AccessLog) []byte
+
+func (f AccessLogFormatterFunc) Format(accessLog *AccessLog) []byte {
+	return f(accessLog)
+}
+
+// CombinedFormatter formats the Apache/Nginx combined log format.
+func CombinedFormatter() AccessLogFormatter {
+	return mustTemplateFormatter(CombinedLogFormat, escapeQuoted)
+}
+
+// LTSVFormatter formats Labeled Tab-separated Values (http://ltsv.org).
+func LTSVFormatter() AccessLogFormatter {
+	return mustTemplateFormatter(LTSVLogFormat, escapeLTSV)
+}
+
+func LogfmtFormatter() AccessLogFormatter {
+	return mustTemplateFormatter(LogfmtLogFormat, escapeLogfmt)
+}
+
+// NewTemplateFormatter formats entries with a template such as `${method} ${uri} ${status}`.
+// Empty values are written as "-", and quotes and control characters are escaped.
+func NewTemplateFormatter(template string) (AccessLogFormatter, error) {
+	return newTemplateFormatter(template, escapeQuoted)
+}
+
+// NewAccessLogFormatter returns a preset by name (combined, ltsv, logfmt or ecs),
+// or the template formatter of format.
+func NewAccessLogFormatter(format string) (AccessLogFormatter, error) {
+	switch strings.ToLower(format) {
+	case "combined":
+		return CombinedFormatter(), nil
+	case "ltsv":
+		return LTSVFormatter(), nil
+	case "logfmt":
+		return LogfmtFormatter(), nil
+	case "ecs":
+		return ECSFormatter(), nil
+	}
+	return NewTemplateFormatter(format)
+}
+
+type templateFormatter struct {
+	literals []string
+	values   []func(accessLog *AccessLog) string
+	escape   func(s string) string
+}
+
+func newTemplateFormatter(template string, escape func(s string) string) (*templateFormatter, error) {
+	f := &templateFormatter{escape: escape}
+	rest := template
+	for {
+		start := strings.Index(rest, "${")
+		if start == -1 {
+			f.literals = append(f.literals, rest)
+			return f, nil
+		}
+		end := strings.Index(rest[start:], "}")
+		if end == -1 {
+			return nil, fmt.Errorf("Unclosed variable in accesslog template %q", template)
+		}
+		value, err := accessLogTemplateValue(rest[start+2 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		f.literals = append(f.literals, rest[:start])
+		f.values = append(f.values, value)
+		rest = rest[start+end+1:]
+	}
+}
+
+func mustTemplateFormatter(template string, escape func(s string) string) *templateFormatter {
+	f, err := newTemplateFormatter(template, escape)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func (f *templateFormatter) Format(accessLog *AccessLog) []byte {
+	var buf bytes.Buffer
+	for i, literal := range f.literals {
+		buf.WriteString(literal)
+		if i < len(f.values) {
+			buf.WriteString(f.escape(f.values[i](accessLog)))
+		}
+	}
+	return buf.Bytes()
+}
+
+func accessLogTemplateValue(name string) (func(accessLog *AccessLog) string, error) {
+	switch name {
+	case "time_local":
+		return func(accessLog *AccessLog) string { return accessLog.Timestamp.Format("02/Jan/2006:15:04:05 -0700") }, nil
+	case "time_iso8601":
+		return func(accessLog *AccessLog) string { return accessLog.Timestamp.Format(time.RFC3339Nano) }, nil
+	case "latency_ms":
+		return func(accessLog *AccessLog) string {
+			return strconv.FormatFloat(accessLog.Latency*1000, 'f', 3, 64)
+		}, nil
+	}
+
+	if i := strings.Index(name, "."); i > 0 {
+		key := name[i+1:]
+		switch name[:i] {
+		case "params":
+			return func(accessLog *AccessLog) string { return formatAccessLogValue(accessLog.Params[key]) }, nil
+		case "headers":
+			return func(accessLog *AccessLog) string {
+				for k, v := range accessLog.Headers {
+					if strings.EqualFold(k, key) {
+						return v
+					}
+				}
+				return ""
+			}, nil
+		case "extra":
+			return func(accessLog *AccessLog) string { return formatAccessLogValue(accessLog.Extra[key]) }, nil
+		}
+	}
+
+	indexes, err := accessLogFieldIndexes([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	return func(accessLog *AccessLog) string {
+		return formatAccessLogValue(reflect.ValueOf(accessLog).Elem().Field(indexes[0]).Interface())
+	}, nil
+}
+
+// formatAccessLogValue formats zero values as "", and maps and bodies as JSON.
+func formatAccessLogValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return formatNonZero(int64(v))
+	case int64:
+		return formatNonZero(v)
+	case float64:
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Map && rv.Len() == 0 {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func formatNonZero(i int64) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.FormatInt(i, 10)
+}
+
+// escapeQuoted escapes like nginx, so that a value can not break out of its quotes.
+func escapeQuoted(s string) string {
+	if s == "" {
+		return "-"
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\' || c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02X`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func escapeLTSV(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func escapeLogfmt(s string) string {
+	if s == "" {
+		return ""
+	}
+	if strings.IndexFunc(s, func(r rune) bool { return r <= ' ' || r == '=' || r == '"' || r == 0x7f }) == -1 {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// ECSFormatter formats Elastic Common Schema JSON.
+// Ids, controller, action and Extra are written as labels.
+func ECSFormatter() AccessLogFormatter {
+	return AccessLogFormatterFunc(func(accessLog *AccessLog) []byte {
+		level, outcome := "info", "success"
+		if IsError()(accessLog) {
+			level, outcome = "error", "failure"
+		}
+
+		request := map[string]interface{}{
+			"method": accessLog.Method,
+			"body":   map[string]interface{}{"bytes": accessLog.RequestLength},
+		}
+		if accessLog.RequestID != "" {
+			request["id"] = accessLog.RequestID
+		}
+		if accessLog.Referer != "" {
+			request["referrer"] = accessLog.Referer
+		}
+		httpFields := map[string]interface{}{
+			"request": request,
+			"response": map[string]interface{}{
+				"status_code": accessLog.Status,
+				"body":        map[string]interface{}{"bytes": accessLog.BytesSent},
+			},
+		}
+		if version := strings.TrimPrefix(accessLog.Proto, "HTTP/"); version != "" {
+			httpFields["version"] = version
+		}
+
+		doc := map[string]interface{}{
+			"@timestamp": accessLog.Timestamp.UTC().Format(time.RFC3339Nano),
+			"ecs":        map[string]interface{}{"version": "8.11.0"},
+			"message":    "accesslog",
+			"log":        map[string]interface{}{"level": level},
+			"event": map[string]interface{}{
+				"kind":     "event",
+				"category": []string{"web"},
+				"outcome":  outcome,
+				"duration": int64(accessLog.Latency * float64(time.Second)),
+			},
+			"http": httpFields,
+			"url": map[string]interface{}{
+				"original": accessLog.Uri,
+				"path":     accessLog.Path,
+				"domain":   accessLog.Host,
+			},
+		}
+		if accessLog.RemoteIP != "" {
+			doc["client"] = map[string]interface{}{"ip": accessLog.RemoteIP}
+		}
+		if accessLog.UserAgent != "" {
+			doc["user_agent"] = map[string]interface{}{"original": accessLog.UserAgent}
+		}
+		if accessLog.UserId != 0 {
+			doc["user"] = map[string]interface{}{"id": strconv.FormatInt(accessLog.UserId, 10)}
+		}
+		if accessLog.Hostname != "" {
+			doc["host"] = map[string]interface{}{"hostname": accessLog.Hostname}
+		}
+		if accessLog.TraceID != "" {
+			doc["trace"] = map[string]interface{}{"id": accessLog.TraceID}
+			doc["span"] = map[string]interface{}{"id": accessLog.SpanID}
+		}
+		if accessLog.Error != "" {
+			doc["error"] = map[string]interface{}{"message": accessLog.Error}
+		}
+
+		labels := map[string]string{}
+		for k, v := range accessLog.Extra {
+			labels[k] = formatAccessLogValue(v)
+		}
+		for k, v := range map[string]string{
+			"action_id":  accessLog.ActionID,
+			"session_id": accessLog.SessionID,
+			"controller": accessLog.Controller,
+			"action":     accessLog.Action,
+		} {
+			if v != "" {
+				labels[k] = v
+			}
+		}
+		if len(labels) > 0 {
+			doc["labels"] = labels
+		}
+
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return nil
+		}
+		return b
+	})
+}
+
+type formatAccessLogWriter struct {
+	formatter AccessLogFormatter
+
+	mutex  sync.Mutex
+	out    io.Writer
+	file   io.Closer
+	closed bool
+}
+
+// FormatLogWriter writes a line formatted by formatter for every entry to out.
+func FormatLogWriter(out io.Writer, formatter AccessLogFormatter) AccessLogWriter {
+	return &formatAccessLogWriter{out: out, formatter: formatter}
+}
+
+// NewFormatFileLogWriter is FormatLogWriter for a file rotated by options.
+func NewFormatFileLogWriter(filename string, options RotateOptions, formatter AccessLogFormatter) (AccessLogWriter, error) {
+	file, err := openRotatingFile(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	return &formatAccessLogWriter{out: file, file: file, formatter: formatter}, nil
+}
+
+func (w *formatAccessLogWriter) Write(accessLog *AccessLog) {
+	line := w.formatter.Format(accessLog)
+	if line == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return
+	}
+	w.out.Write(append(line, '\n'))
+}
+
+// Close closes the file of NewFormatFileLogWriter. The output of FormatLogWriter is left open.
+func (w *formatAccessLogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,62 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestAccessLogFormatter(t *testing.T) {
+	accessLog := &AccessLog{
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("KST", 9*60*60)),
+		RequestID: "req-1", RemoteIP: "203.0.113.9", Host: "api.example.com", Method: "GET", Proto: "HTTP/1.1",
+		Uri: "/orders?q=1", Path: "/orders", UserAgent: `curl/8.0 "quoted"`, Status: 200, BytesSent: 512,
+		Latency: 0.25, Controller: "OrderController", Action: "GetAll", Extra: map[string]interface{}{"tenant": "a"},
+	}
+
+	t.Run("Combined", func(t *testing.T) {
+		test.Equals(t,
+			`203.0.113.9 - - [02/Jan/2026:03:04:05 +0900] "GET /orders?q=1 HTTP/1.1" 200 512 "-" "curl/8.0 \x22quoted\x22"`,
+			string(CombinedFormatter().Format(accessLog)))
+	})
+
+	t.Run("Logfmt", func(t *testing.T) {
+		test.Equals(t,
+			`time=2026-01-02T03:04:05+09:00 request_id=req-1 remote_ip=203.0.113.9 method=GET uri="/orders?q=1"`+
+				` status=200 latency=0.25 bytes_in= bytes_out=512 controller=OrderController action=GetAll user_id= error=`,
+			string(LogfmtFormatter().Format(accessLog)))
+	})
+
+	t.Run("Template", func(t *testing.T) {
+		f, err := NewAccessLogFormatter("${method} ${path} ${latency_ms}ms ${extra.tenant} ${params.missing}")
+		test.Ok(t, err)
+		test.Equals(t, "GET /orders 250.000ms a -", string(f.Format(accessLog)))
+
+		_, err = NewTemplateFormatter("${no_such_field}")
+		test.Assert(t, err != nil, "expected unknown field error")
+		_, err = NewTemplateFormatter("${method")
+		test.Assert(t, err != nil, "expected unclosed variable error")
+	})
+
+	t.Run("ECS", func(t *testing.T) {
+		var doc map[string]interface{}
+		test.Ok(t, json.Unmarshal(ECSFormatter().Format(accessLog), &doc))
+		test.Equals(t, "2026-01-01T18:04:05Z", doc["@timestamp"])
+		test.Equals(t, float64(250*time.Millisecond), doc["event"].(map[string]interface{})["duration"])
+		test.Equals(t, map[string]interface{}{
+			"method": "GET", "id": "req-1", "body": map[string]interface{}{"bytes": float64(0)},
+		}, doc["http"].(map[string]interface{})["request"])
+		test.Equals(t, "a", doc["labels"].(map[string]interface{})["tenant"])
+	})
+
+	t.Run("Writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		FormatLogWriter(&buf, LTSVFormatter()).Write(&AccessLog{Method: "GET", Uri: "/a\tb"})
+		test.Equals(t, "time:01/Jan/0001:00:00:00 +0000\thost:-\tuser:-\tmethod:GET\turi:/a\\tb\tprotocol:-"+
+			"\tstatus:-\tsize:-\treqsize:-\treferer:-\tua:-\tvhost:-\treqtime:-\treqid:-\tcontroller:-\taction:-\terror:-\n",
+			buf.String())
+	})
+}
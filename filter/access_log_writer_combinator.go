@@ -0,0 +1,174 @@
+package filter
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type AccessLogPredicate func(accessLog *AccessLog) bool
+
+// IsError matches entries with an error or a 5xx status.
+func IsError() AccessLogPredicate {
+	return func(accessLog *AccessLog) bool {
+		return accessLog.Error != "" || accessLog.Status >= 500
+	}
+}
+
+func StatusAtLeast(status int) AccessLogPredicate {
+	return func(accessLog *AccessLog) bool {
+		return accessLog.Status >= status
+	}
+}
+
+func SlowerThan(d time.Duration) AccessLogPredicate {
+	return func(accessLog *AccessLog) bool {
+		return accessLog.Latency >= d.Seconds()
+	}
+}
+
+// AnyOf matches entries matched by at least one of predicates.
+func AnyOf(predicates ...AccessLogPredicate) AccessLogPredicate {
+	return func(accessLog *AccessLog) bool {
+		for _, p := range predicates {
+			if p(accessLog) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type multiAccessLogWriter struct {
+	writers []AccessLogWriter
+}
+
+// Multi writes every entry to all writers. A writer that panics does not affect the others.
+func Multi(writers ...AccessLogWriter) AccessLogWriter {
+	var w multiAccessLogWriter
+	for _, writer := range writers {
+		if writer != nil {
+			w.writers = append(w.writers, writer)
+		}
+	}
+	return &w
+}
+
+func (w *multiAccessLogWriter) Write(accessLog *AccessLog) {
+	for _, writer := range w.writers {
+		writeIsolated(writer, accessLog)
+	}
+}
+
+func (w *multiAccessLogWriter) innerWriters() []AccessLogWriter {
+	return w.writers
+}
+
+func (w *multiAccessLogWriter) Flush(ctx context.Context) error {
+	return forEachWriter(w.writers, func(writer AccessLogWriter) error {
+		if flusher, ok := writer.(AccessLogFlusher); ok {
+			return flusher.Flush(ctx)
+		}
+		return nil
+	})
+}
+
+func (w *multiAccessLogWriter) Close(ctx context.Context) error {
+	return forEachWriter(w.writers, func(writer AccessLogWriter) error {
+		return CloseAccessLogWriter(ctx, writer)
+	})
+}
+
+type filterAccessLogWriter struct {
+	predicate AccessLogPredicate
+	writer    AccessLogWriter
+}
+
+// Filter writes only the entries matched by predicate, e.g. Filter(IsError(), w).
+func Filter(predicate AccessLogPredicate, w AccessLogWriter) AccessLogWriter {
+	return &filterAccessLogWriter{predicate: predicate, writer: w}
+}
+
+func (w *filterAccessLogWriter) Write(accessLog *AccessLog) {
+	if w.predicate(accessLog) {
+		w.writer.Write(accessLog)
+	}
+}
+
+func (w *filterAccessLogWriter) innerWriters() []AccessLogWriter {
+	return []AccessLogWriter{w.writer}
+}
+
+func (w *filterAccessLogWriter) Flush(ctx context.Context) error {
+	if flusher, ok := w.writer.(AccessLogFlusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
+}
+
+func (w *filterAccessLogWriter) Close(ctx context.Context) error {
+	return CloseAccessLogWriter(ctx, w.writer)
+}
+
+// Sample writes a rate (0 to 1) of the entries to w.
+// Errors and entries matched by one of alwaysKeep are always written.
+func Sample(rate float64, w AccessLogWriter, alwaysKeep ...AccessLogPredicate) AccessLogWriter {
+	keep := AnyOf(append([]AccessLogPredicate{IsError()}, alwaysKeep...)...)
+
+	var mutex sync.Mutex
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return Filter(func(accessLog *AccessLog) bool {
+		if keep(accessLog) {
+			return true
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		return random.Float64() < rate
+	}, w)
+}
+
+// routeAccessLogWriter flushes and closes its writers like Multi.
+type routeAccessLogWriter struct {
+	multiAccessLogWriter
+	route func(accessLog *AccessLog) AccessLogWriter
+}
+
+// Route writes every entry to the writer chosen by route. Entries routed to nil are discarded.
+// Pass the writers route chooses from as writers, so that Flush and Close reach them.
+func Route(route func(accessLog *AccessLog) AccessLogWriter, writers ...AccessLogWriter) AccessLogWriter {
+	w := &routeAccessLogWriter{route: route}
+	for _, writer := range writers {
+		if writer != nil {
+			w.writers = append(w.writers, writer)
+		}
+	}
+	return w
+}
+
+func (w *routeAccessLogWriter) Write(accessLog *AccessLog) {
+	if writer := w.route(accessLog); writer != nil {
+		writeIsolated(writer, accessLog)
+	}
+}
+
+func writeIsolated(w AccessLogWriter, accessLog *AccessLog) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithField("panic", r).Error("Fail to write accesslog")
+		}
+	}()
+	w.Write(accessLog)
+}
+
+func forEachWriter(writers []AccessLogWriter, f func(w AccessLogWriter) error) error {
+	var firstErr error
+	for _, w := range writers {
+		if err := f(w); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,101 @@
+package filter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type panicAccessLogWriter struct{}
+
+func (panicAccessLogWriter) Write(*AccessLog) { panic("broken writer") }
+
+func TestAccessLogWriterCombinators(t *testing.T) {
+	ok, failed := &AccessLog{Status: 200}, &AccessLog{Status: 502}
+
+	t.Run("multi-filter", func(t *testing.T) {
+		all, errors := &recordAccessLogWriter{}, &recordAccessLogWriter{}
+		w := Multi(panicAccessLogWriter{}, all, Filter(IsError(), errors))
+		w.Write(ok)
+		w.Write(failed)
+		test.Equals(t, 2, all.len())
+		test.Equals(t, 1, errors.len())
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		sampled := &recordAccessLogWriter{}
+		w := Sample(0, sampled, SlowerThan(time.Second))
+		w.Write(ok)
+		w.Write(failed)
+		w.Write(&AccessLog{Status: 200, Latency: 1.5})
+		test.Equals(t, 2, sampled.len())
+	})
+
+	t.Run("spec", func(t *testing.T) {
+		spec, err := ParseAccessLogWriterSpec([]byte(`{
+			"type": "multi",
+			"writers": [
+				{"type": "default"},
+				{"type": "filter", "match": {"min_status": 500}, "writers": [{"type": "default"}]},
+				{"type": "sample", "rate": 0.1, "writers": [{"type": "default"}]}
+			]
+		}`))
+		test.Ok(t, err)
+		_, err = NewAccessLogWriter(spec)
+		test.Ok(t, err)
+
+		_, err = NewAccessLogWriter(AccessLogWriterSpec{Type: "filter", Writers: []AccessLogWriterSpec{{}}})
+		test.Assert(t, err != nil, "filter without match must fail")
+
+		_, err = NewAccessLogWriter(AccessLogWriterSpec{Type: "syslog"})
+		test.Assert(t, err != nil && strings.Contains(err.Error(), "Unknown accesslog writer type"), "unexpected error: %v", err)
+
+		for _, rate := range []float64{0, -0.1, 1.5} {
+			_, err = NewAccessLogWriter(AccessLogWriterSpec{Type: "sample", Rate: rate, Writers: []AccessLogWriterSpec{{}}})
+			test.Assert(t, err != nil, "sample with rate %v must fail", rate)
+		}
+	})
+
+	t.Run("spec-rotate", func(t *testing.T) {
+		spec, err := ParseAccessLogWriterSpec([]byte(`{
+			"type": "file", "filename": "access.log",
+			"rotate": {"max_size": 1048576, "daily": true, "max_backups": 7, "max_age": "168h", "compress": true, "reopen_on_sighup": true}
+		}`))
+		test.Ok(t, err)
+		options, err := spec.Rotate.options()
+		test.Ok(t, err)
+		test.Equals(t, RotateOptions{
+			MaxSize:        1 << 20,
+			Daily:          true,
+			MaxBackups:     7,
+			MaxAge:         168 * time.Hour,
+			Compress:       true,
+			ReopenOnSIGHUP: true,
+		}, options)
+
+		_, err = NewAccessLogWriter(AccessLogWriterSpec{Type: "file", Filename: "access.log", Rotate: &AccessLogRotateSpec{MaxAge: "a week"}})
+		test.Assert(t, err != nil, "invalid max_age must fail")
+	})
+
+	t.Run("route", func(t *testing.T) {
+		errors := AsyncWriter(&recordAccessLogWriter{}, AsyncWriterOptions{})
+		others := AsyncWriter(&recordAccessLogWriter{}, AsyncWriterOptions{})
+		w := Route(func(accessLog *AccessLog) AccessLogWriter {
+			if IsError()(accessLog) {
+				return errors
+			}
+			return others
+		}, errors, others)
+		w.Write(ok)
+		w.Write(failed)
+
+		test.Ok(t, CloseAccessLogWriter(context.Background(), w))
+		test.Equals(t, uint64(1), errors.Stats().Written)
+		test.Equals(t, uint64(1), others.Stats().Written)
+		w.Write(ok)
+		test.Equals(t, uint64(1), others.Stats().Dropped)
+	})
+}
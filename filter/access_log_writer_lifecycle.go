@@ -0,0 +1,82 @@
+package filter
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// AccessLogFlusher is implemented by writers that buffer entries.
+type AccessLogFlusher interface {
+	Flush(ctx context.Context) error
+}
+
+// accessLogCloser is implemented by writers whose Close honors a deadline.
+type accessLogCloser interface {
+	Close(ctx context.Context) error
+}
+
+// CloseAccessLogWriter flushes w when it is an AccessLogFlusher and closes it when it has
+// a Close(ctx) or an io.Closer Close method. It gives up when ctx is done.
+func CloseAccessLogWriter(ctx context.Context, w AccessLogWriter) error {
+	if flusher, ok := w.(AccessLogFlusher); ok {
+		if err := flusher.Flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	switch closer := w.(type) {
+	case accessLogCloser:
+		return closer.Close(ctx)
+	case io.Closer:
+		done := make(chan error, 1)
+		go func() { done <- closer.Close() }()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// CloseOnShutdown closes writers when e.Shutdown is called, waiting at most timeout.
+// http.Server does not wait for its shutdown hooks, so wait on the returned channel before the process exits:
+//
+//	done := filter.CloseOnShutdown(e, 5*time.Second, writer)
+//	...
+//	e.Shutdown(ctx)
+//	<-done
+func CloseOnShutdown(e *echo.Echo, timeout time.Duration, writers ...AccessLogWriter) <-chan struct{} {
+	done := make(chan struct{})
+	var once sync.Once
+	e.Server.RegisterOnShutdown(func() {
+		once.Do(func() {
+			defer close(done)
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			var wg sync.WaitGroup
+			for _, w := range writers {
+				if w == nil {
+					continue
+				}
+				wg.Add(1)
+				go func(w AccessLogWriter) {
+					defer wg.Done()
+					if err := CloseAccessLogWriter(ctx, w); err != nil {
+						logrus.WithError(err).Error("Fail to close accesslog writer")
+					}
+				}(w)
+			}
+			wg.Wait()
+		})
+	})
+	return done
+}
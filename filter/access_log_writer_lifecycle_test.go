@@ -0,0 +1,65 @@
+package filter
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type closerAccessLogWriter struct {
+	recordAccessLogWriter
+	closed  int32
+	release chan struct{}
+}
+
+func (w *closerAccessLogWriter) Close() error {
+	if w.release != nil {
+		<-w.release
+	}
+	atomic.StoreInt32(&w.closed, 1)
+	return nil
+}
+
+func TestCloseOnShutdown(t *testing.T) {
+	t.Run("close", func(t *testing.T) {
+		e := echo.New()
+		inner := &recordAccessLogWriter{}
+		async := AsyncWriter(inner, AsyncWriterOptions{FlushInterval: time.Hour})
+		closer := &closerAccessLogWriter{}
+		done := CloseOnShutdown(e, time.Minute, async, closer, nil)
+
+		async.Write(&AccessLog{Status: 200})
+		test.Ok(t, e.Shutdown(context.Background()))
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("writers were not closed")
+		}
+		test.Equals(t, 1, inner.len())
+		test.Equals(t, int32(1), atomic.LoadInt32(&closer.closed))
+
+		async.Write(&AccessLog{Status: 200})
+		test.Equals(t, uint64(1), async.Stats().Dropped)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		e := echo.New()
+		closer := &closerAccessLogWriter{release: make(chan struct{})}
+		defer close(closer.release)
+		done := CloseOnShutdown(e, 10*time.Millisecond, closer)
+
+		test.Ok(t, e.Shutdown(context.Background()))
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("CloseOnShutdown must give up after the timeout")
+		}
+		test.Equals(t, int32(0), atomic.LoadInt32(&closer.closed))
+	})
+}
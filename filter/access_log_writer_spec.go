@@ -0,0 +1,335 @@
+package filter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// AccessLogWriterSpec describes a writer tree, so that it can be configured from JSON:
+//
+//	{
+//	  "type": "multi",
+//	  "writers": [
+//	    {"type": "kafka", "brokers": ["kafka-1:9092"], "topic": "accesslog", "spool_dir": "/var/spool/app"},
+//	    {
+//	      "type": "filter",
+//	      "match": {"errors": true, "slower_than": "1s"},
+//	      "writers": [{"type": "file", "filename": "/var/log/app/access.log", "rotate": {"daily": true, "max_age": "168h"}}]
+//	    }
+//	  ]
+//	}
+type AccessLogWriterSpec struct {
+	// Type is one of default, file, kafka, multi, filter, sample and async.
+	// filter, sample and async wrap their first writer.
+	Type string `json:"type"`
+
+	Filename string               `json:"filename,omitempty"`
+	Rotate   *AccessLogRotateSpec `json:"rotate,omitempty"`
+	// Format is the line format of a file: combined, ltsv, logfmt, ecs or a ${field} template. Default: JSON
+	Format  string   `json:"format,omitempty"`
+	Brokers []string `json:"brokers,omitempty"`
+	Topic   string   `json:"topic,omitempty"`
+	// Key is the kafka message key: session, user or request. Default: none
+	Key string `json:"key,omitempty"`
+	// SpoolDir spools the kafka messages that fail to be delivered, see KafkaSpool.
+	// Wrap the writer in an async writer, as spooling syncs to disk on every write.
+	SpoolDir string `json:"spool_dir,omitempty"`
+	// Version is the kafka broker version, e.g. "2.8.0".
+	Version string `json:"version,omitempty"`
+	// Compression is none, gzip, snappy, lz4 or zstd. Default: none
+	Compression string         `json:"compression,omitempty"`
+	Idempotent  bool           `json:"idempotent,omitempty"`
+	TLS         *KafkaTLSSpec  `json:"tls,omitempty"`
+	SASL        *KafkaSASLSpec `json:"sasl,omitempty"`
+
+	Writers []AccessLogWriterSpec `json:"writers,omitempty"`
+
+	// Match selects the entries a filter writes, or the entries a sample always keeps.
+	Match *AccessLogMatchSpec `json:"match,omitempty"`
+	// Rate is the fraction of the other entries a sample keeps, in (0, 1].
+	Rate float64 `json:"rate,omitempty"`
+
+	QueueSize int    `json:"queue_size,omitempty"`
+	Workers   int    `json:"workers,omitempty"`
+	Policy    string `json:"policy,omitempty"` // drop, block or sample
+}
+
+// AccessLogRotateSpec configures the rotation of a file, see RotateOptions.
+type AccessLogRotateSpec struct {
+	MaxSize        int64  `json:"max_size,omitempty"` // bytes
+	Daily          bool   `json:"daily,omitempty"`
+	MaxBackups     int    `json:"max_backups,omitempty"`
+	MaxAge         string `json:"max_age,omitempty"` // e.g. "168h"
+	Compress       bool   `json:"compress,omitempty"`
+	ReopenOnSIGHUP bool   `json:"reopen_on_sighup,omitempty"`
+}
+
+// KafkaTLSSpec enables TLS. The system roots are trusted unless CAFile is set.
+type KafkaTLSSpec struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+type KafkaSASLSpec struct {
+	// Mechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512. Default: PLAIN
+	Mechanism string `json:"mechanism,omitempty"`
+	User      string `json:"user"`
+	Password  string `json:"password"`
+}
+
+// AccessLogMatchSpec matches an entry when any of its conditions holds.
+type AccessLogMatchSpec struct {
+	Errors     bool   `json:"errors,omitempty"`
+	MinStatus  int    `json:"min_status,omitempty"`
+	SlowerThan string `json:"slower_than,omitempty"`
+}
+
+func ParseAccessLogWriterSpec(data []byte) (AccessLogWriterSpec, error) {
+	var spec AccessLogWriterSpec
+	err := json.Unmarshal(data, &spec)
+	return spec, err
+}
+
+func NewAccessLogWriter(spec AccessLogWriterSpec) (AccessLogWriter, error) {
+	switch strings.ToLower(spec.Type) {
+	case "", "default":
+		return &defaultAccessLogWriter{}, nil
+	case "file":
+		if spec.Filename == "" {
+			return nil, fmt.Errorf("file accesslog writer requires a filename")
+		}
+		var rotate RotateOptions
+		if spec.Rotate != nil {
+			var err error
+			if rotate, err = spec.Rotate.options(); err != nil {
+				return nil, err
+			}
+		}
+		if spec.Format != "" {
+			formatter, err := NewAccessLogFormatter(spec.Format)
+			if err != nil {
+				return nil, err
+			}
+			return NewFormatFileLogWriter(spec.Filename, rotate, formatter)
+		}
+		return NewFileLogWriter(spec.Filename, rotate)
+	case "kafka":
+		options, err := spec.kafkaOptions()
+		if err != nil {
+			return nil, err
+		}
+		return NewKafkaAccessLogWriter(spec.Brokers, spec.Topic, options...)
+	case "multi":
+		writers, err := newAccessLogWriters(spec.Writers)
+		if err != nil {
+			return nil, err
+		}
+		return Multi(writers...), nil
+	}
+
+	switch strings.ToLower(spec.Type) {
+	case "filter", "sample", "async":
+	default:
+		return nil, fmt.Errorf("Unknown accesslog writer type %q", spec.Type)
+	}
+	if len(spec.Writers) != 1 {
+		return nil, fmt.Errorf("%s accesslog writer requires exactly one writer", spec.Type)
+	}
+	inner, err := NewAccessLogWriter(spec.Writers[0])
+	if err != nil {
+		return nil, err
+	}
+	w, err := wrapAccessLogWriter(spec, inner)
+	if err != nil {
+		closeAccessLogWriters(inner)
+		return nil, err
+	}
+	return w, nil
+}
+
+func wrapAccessLogWriter(spec AccessLogWriterSpec, inner AccessLogWriter) (AccessLogWriter, error) {
+	switch strings.ToLower(spec.Type) {
+	case "filter":
+		if spec.Match == nil {
+			return nil, fmt.Errorf("filter accesslog writer requires match")
+		}
+		predicate, err := spec.Match.predicate()
+		if err != nil {
+			return nil, err
+		}
+		return Filter(predicate, inner), nil
+	case "sample":
+		if spec.Rate <= 0 || spec.Rate > 1 {
+			return nil, fmt.Errorf("sample accesslog writer requires a rate in (0, 1], got %v", spec.Rate)
+		}
+		var alwaysKeep []AccessLogPredicate
+		if spec.Match != nil {
+			predicate, err := spec.Match.predicate()
+			if err != nil {
+				return nil, err
+			}
+			alwaysKeep = append(alwaysKeep, predicate)
+		}
+		return Sample(spec.Rate, inner, alwaysKeep...), nil
+	case "async":
+		options := AsyncWriterOptions{QueueSize: spec.QueueSize, Workers: spec.Workers}
+		switch strings.ToLower(spec.Policy) {
+		case "", "drop":
+			options.Policy = AsyncDrop
+		case "block":
+			options.Policy = AsyncBlock
+		case "sample":
+			options.Policy = AsyncSample
+		default:
+			return nil, fmt.Errorf("Unknown async policy %q", spec.Policy)
+		}
+		return AsyncWriter(inner, options), nil
+	}
+	return nil, fmt.Errorf("Unknown accesslog writer type %q", spec.Type)
+}
+
+func (spec AccessLogWriterSpec) kafkaOptions() ([]KafkaWriterOption, error) {
+	var options []KafkaWriterOption
+	switch strings.ToLower(spec.Key) {
+	case "":
+	case "session":
+		options = append(options, KafkaKeyBySessionID())
+	case "user":
+		options = append(options, KafkaKeyByUserID())
+	case "request":
+		options = append(options, KafkaKeyByRequestID())
+	default:
+		return nil, fmt.Errorf("Unknown kafka key %q", spec.Key)
+	}
+	if spec.SpoolDir != "" {
+		options = append(options, KafkaSpool(KafkaSpoolOptions{Dir: spec.SpoolDir}))
+	}
+	if spec.Version != "" {
+		options = append(options, KafkaVersion(spec.Version))
+	}
+	if spec.Compression != "" {
+		var codec sarama.CompressionCodec
+		if err := codec.UnmarshalText([]byte(strings.ToLower(spec.Compression))); err != nil {
+			return nil, fmt.Errorf("Unknown kafka compression %q", spec.Compression)
+		}
+		options = append(options, KafkaCompression(codec))
+	}
+	if spec.Idempotent {
+		options = append(options, KafkaIdempotent())
+	}
+	if spec.TLS != nil {
+		tlsConfig, err := spec.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, KafkaTLS(tlsConfig))
+	}
+	if spec.SASL != nil {
+		switch mechanism := strings.ToUpper(spec.SASL.Mechanism); mechanism {
+		case "", sarama.SASLTypePlaintext:
+			options = append(options, KafkaSASLPlain(spec.SASL.User, spec.SASL.Password))
+		case sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+			options = append(options, KafkaSASLSCRAM(sarama.SASLMechanism(mechanism), spec.SASL.User, spec.SASL.Password))
+		default:
+			return nil, fmt.Errorf("Unknown kafka SASL mechanism %q", spec.SASL.Mechanism)
+		}
+	}
+	return options, nil
+}
+
+func (r AccessLogRotateSpec) options() (RotateOptions, error) {
+	options := RotateOptions{
+		MaxSize:        r.MaxSize,
+		Daily:          r.Daily,
+		MaxBackups:     r.MaxBackups,
+		Compress:       r.Compress,
+		ReopenOnSIGHUP: r.ReopenOnSIGHUP,
+	}
+	if r.MaxAge != "" {
+		d, err := time.ParseDuration(r.MaxAge)
+		if err != nil {
+			return RotateOptions{}, fmt.Errorf("Invalid max_age %q: %v", r.MaxAge, err)
+		}
+		options.MaxAge = d
+	}
+	return options, nil
+}
+
+func (t KafkaTLSSpec) config() (*tls.Config, error) {
+	config := &tls.Config{ServerName: t.ServerName, InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Fail to read kafka CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("No certificate found in kafka CA file %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Fail to load kafka client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func newAccessLogWriters(specs []AccessLogWriterSpec) ([]AccessLogWriter, error) {
+	var writers []AccessLogWriter
+	for _, spec := range specs {
+		w, err := NewAccessLogWriter(spec)
+		if err != nil {
+			closeAccessLogWriters(writers...)
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	return writers, nil
+}
+
+// closeAccessLogWriters releases the writers created before the construction of a tree failed.
+func closeAccessLogWriters(writers ...AccessLogWriter) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, w := range writers {
+		if err := CloseAccessLogWriter(ctx, w); err != nil {
+			logrus.WithError(err).Error("Fail to close accesslog writer")
+		}
+	}
+}
+
+func (m AccessLogMatchSpec) predicate() (AccessLogPredicate, error) {
+	var predicates []AccessLogPredicate
+	if m.Errors {
+		predicates = append(predicates, IsError())
+	}
+	if m.MinStatus > 0 {
+		predicates = append(predicates, StatusAtLeast(m.MinStatus))
+	}
+	if m.SlowerThan != "" {
+		d, err := time.ParseDuration(m.SlowerThan)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid slower_than %q: %v", m.SlowerThan, err)
+		}
+		predicates = append(predicates, SlowerThan(d))
+	}
+	if len(predicates) == 0 {
+		return nil, fmt.Errorf("match requires at least one condition")
+	}
+	return AnyOf(predicates...), nil
+}
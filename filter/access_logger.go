@@ -6,36 +6,37 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net"
 	"net/http"
 	"os"
-	"regexp"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/jaehue/converter"
+	"github.com/jaehue/echo-kit/jwtutil"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/random"
 	"github.com/sirupsen/logrus"
-)
-
-var (
-	passwordRegex = regexp.MustCompile(`"(password|passwd)":(\s)*"(.*)"`)
+	"go.opentelemetry.io/otel/trace"
 )
 
 type AccessLog struct {
 	Id        int64  `json:"-"`
 	SessionID string `json:"session_id,omitempty"`
 	RequestID string `json:"request_id,omitempty"`
+	ActionID  string `json:"action_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+	SpanID    string `json:"span_id,omitempty"`
 
 	Timestamp     time.Time `json:"timestamp,omitempty"`
 	RemoteIP      string    `json:"remote_ip,omitempty"`
 	Host          string    `json:"host,omitempty"`
 	Uri           string    `json:"uri,omitempty"`
 	Method        string    `json:"method,omitempty"`
+	Proto         string    `json:"proto,omitempty"`
 	Path          string    `json:"path,omitempty"`
 	Referer       string    `json:"referer,omitempty"`
 	UserAgent     string    `json:"user_agent,omitempty"`
@@ -47,37 +48,147 @@ type AccessLog struct {
 
 	Body       interface{}            `json:"body,omitempty"`
 	Params     map[string]interface{} `json:"params,omitempty"`
+	Headers    map[string]string      `json:"headers,omitempty"`
 	Controller string                 `json:"controller,omitempty"`
 	Action     string                 `json:"action,omitempty"`
 	UserId     int64                  `json:"userId,omitempty"`
 	Error      string                 `json:"error,omitempty"`
+	Stack      string                 `json:"stack,omitempty"`
+	Slow       bool                   `json:"slow,omitempty"`
+
+	ResponseBody interface{}            `json:"response_body,omitempty"`
+	Extra        map[string]interface{} `json:"extra,omitempty"`
+
+	GoroutineDump string `json:"goroutine_dump,omitempty"`
 }
 
 type AccessLogWriter interface{ Write(accessLog *AccessLog) }
 
+type AccessLoggerConfig struct {
+	Skipper middleware.Skipper
+	Writer  AccessLogWriter
+	// IPExtractor resolves AccessLog.RemoteIP. Default: e.IPExtractor when set, or else the peer address,
+	// as X-Forwarded-For can be set by any client. See TrustedProxyIPExtractor.
+	IPExtractor echo.IPExtractor
+	// Redactor masks sensitive values of the body, parameters and headers. Default: DefaultRedactRules
+	Redactor *Redactor
+	// Headers lists the request headers to record.
+	Headers []string
+	// MaxBodySize limits the request body recorded in AccessLog.Body. Default: 64KB
+	MaxBodySize int64
+	// ResponseCapture records the response body of the matching requests in AccessLog.ResponseBody.
+	ResponseCapture *ResponseCaptureConfig
+	// Enrichers add fields to the entry after the handler has returned.
+	Enrichers []func(c echo.Context, accessLog *AccessLog)
+	// SlowRequest flags the requests slower than their threshold and calls hooks with them.
+	SlowRequest *SlowRequestConfig
+	// OmitFields lists the fields, by their JSON name, that are never written, e.g. "user_agent".
+	OmitFields []string
+}
+
+const accessLogContextKey = "accessLog"
+
+// AddLogField adds a field to the AccessLog.Extra of the current request.
+func AddLogField(c echo.Context, key string, value interface{}) {
+	accessLog, ok := c.Get(accessLogContextKey).(*AccessLog)
+	if !ok {
+		return
+	}
+	if accessLog.Extra == nil {
+		accessLog.Extra = make(map[string]interface{})
+	}
+	accessLog.Extra[key] = value
+}
+
 func AccessLogger(writer AccessLogWriter) echo.MiddlewareFunc {
+	return AccessLoggerWithConfig(AccessLoggerConfig{Writer: writer})
+}
+
+func AccessLoggerWithConfig(config AccessLoggerConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	writer := config.Writer
 	if writer == nil {
 		writer = &defaultAccessLogWriter{}
 	}
+	redactor := config.Redactor
+	if redactor == nil {
+		redactor = defaultRedactor
+	}
+
+	maxBodySize := config.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = 64 * 1024
+	}
+	responseCapture, err := newResponseCapture(config.ResponseCapture)
+	if err != nil {
+		panic(err)
+	}
+	slowRequest, err := newSlowRequest(config.SlowRequest)
+	if err != nil {
+		panic(err)
+	}
+	omitFields, err := accessLogFieldIndexes(config.OmitFields)
+	if err != nil {
+		panic(err)
+	}
 
 	hostname, err := os.Hostname()
-	logrus.WithError(err).Error("Fail to get hostname")
+	if err != nil {
+		logrus.WithError(err).Error("Fail to get hostname")
+	}
 
 	var echoRouter echoRouter
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
 			req := c.Request()
 
 			accessLog := newAccessLog(c.Request())
 
 			accessLog.Hostname = hostname
+			switch {
+			case config.IPExtractor != nil:
+				accessLog.RemoteIP = config.IPExtractor(req)
+			case c.Echo().IPExtractor != nil:
+				accessLog.RemoteIP = c.RealIP()
+			default:
+				accessLog.RemoteIP = echo.ExtractIPDirect()(req)
+			}
+			c.Set(accessLogContextKey, accessLog)
 
-			var body []byte
-			if shouldWriteBodyLog(req, accessLog) {
-				body, _ = ioutil.ReadAll(req.Body)
-				req.Body.Close()
-				req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+			var (
+				slowThreshold time.Duration
+				captureBody   bool
+			)
+			stopWatch := func() string { return "" }
+			if slowRequest != nil {
+				slowThreshold, captureBody = slowRequest.route(req)
+				stopWatch = slowRequest.watch(slowThreshold)
+			}
+
+			bodyKind := requestBodyKind(req)
+			var tee *bodyTee
+			if bodyKind != bodyNone && bodyKind != bodyMultipart && bodyKind != bodyBinary {
+				tee = &bodyTee{ReadCloser: req.Body, max: maxBodySize}
+				if captureBody && slowRequest.config.MaxBodySize > maxBodySize {
+					// the body is limited to maxBodySize afterwards unless the request is slow
+					tee.max = slowRequest.config.MaxBodySize
+				}
+				req.Body = tee
+			}
+
+			var captureWriter *captureResponseWriter
+			if responseCapture != nil && responseCapture.matchRequest(req) {
+				res := c.Response()
+				captureWriter = &captureResponseWriter{ResponseWriter: res.Writer, capture: responseCapture}
+				res.Writer = captureWriter
+				defer func() { res.Writer = captureWriter.ResponseWriter }()
 			}
 
 			start := time.Now()
@@ -93,9 +204,11 @@ func AccessLogger(writer AccessLogWriter) echo.MiddlewareFunc {
 				} else {
 					accessLog.Error = err.Error()
 				}
+				accessLog.Stack = panicStack(err)
 
 			}
 			stop := time.Now()
+			goroutineDump := stopWatch()
 
 			res := c.Response()
 
@@ -106,39 +219,118 @@ func AccessLogger(writer AccessLogWriter) echo.MiddlewareFunc {
 				&converter.Setting{RoundDigit: 6, RoundStrategy: "ceil"},
 			)
 			accessLog.Controller, accessLog.Action = echoRouter.getControllerAndAction(c)
-			if body != nil {
-				body := passwordRegex.ReplaceAll(body, []byte(`"$1": "*"`))
-				var bodyParam interface{}
-				d := json.NewDecoder(bytes.NewBuffer(body))
-				d.UseNumber()
-				if err := d.Decode(&bodyParam); err == nil {
-					accessLog.Body = bodyParam
-				} else {
-					accessLog.Body = string(body)
+			// RequestID may run inside AccessLogger
+			if requestID := RequestIDFromContext(c.Request().Context()); requestID != "" {
+				accessLog.RequestID = requestID
+				accessLog.ActionID = ActionIDFromContext(c.Request().Context())
+			}
+			if spanContext := trace.SpanContextFromContext(c.Request().Context()); spanContext.IsValid() {
+				accessLog.TraceID = spanContext.TraceID().String()
+				accessLog.SpanID = spanContext.SpanID().String()
+			}
+			if authInfo, ok := jwtutil.GetVerifiedAuthInfo(c); ok {
+				accessLog.UserId = authInfo.UserId
+				if authInfo.SessionId != "" {
+					accessLog.SessionID = authInfo.SessionId
 				}
-
+			}
+			if slowRequest != nil && stop.Sub(start) >= slowThreshold {
+				accessLog.Slow = true
+				accessLog.GoroutineDump = goroutineDump
+			}
+			if tee != nil && !accessLog.Slow {
+				tee.limit(maxBodySize)
+			}
+			if bodyKind != bodyNone {
+				accessLog.Body = requestBodyLog(c.Request(), bodyKind, tee, redactor)
+			}
+			if captureWriter != nil && captureWriter.capturing {
+				accessLog.ResponseBody = decodeBodyLog(captureWriter.buf.Bytes(), captureWriter.truncated, redactor)
 			}
 
 			for _, name := range c.ParamNames() {
 				accessLog.Params[name] = c.Param(name)
 			}
+			redactor.RedactMap(accessLog.Params)
+			accessLog.Uri = redactor.RedactURL(accessLog.Uri)
+			accessLog.Referer = redactor.RedactURL(accessLog.Referer)
+
+			if len(config.Headers) > 0 {
+				accessLog.Headers = make(map[string]string)
+				for _, name := range config.Headers {
+					if v := req.Header.Get(name); v != "" {
+						accessLog.Headers[name] = v
+					}
+				}
+				redactor.RedactStringMap(accessLog.Headers)
+			}
+
+			for _, enrich := range config.Enrichers {
+				enrich(c, accessLog)
+			}
+			omitAccessLogFields(accessLog, omitFields)
 
 			writer.Write(accessLog)
+			if accessLog.Slow {
+				slowRequest.notify(accessLog)
+			}
 			return
 		}
 	}
 }
 
-func newAccessLog(req *http.Request) *AccessLog {
-	realIP := req.RemoteAddr
-	if ip := req.Header.Get(HeaderXForwardedFor); ip != "" {
-		realIP = strings.Split(ip, ", ")[0]
-	} else if ip := req.Header.Get(HeaderXRealIP); ip != "" {
-		realIP = ip
-	} else {
-		realIP, _, _ = net.SplitHostPort(realIP)
+// accessLogFieldIndexes finds the AccessLog fields by their JSON names.
+func accessLogFieldIndexes(names []string) ([]int, error) {
+	t := reflect.TypeOf(AccessLog{})
+	var indexes []int
+	for _, name := range names {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if tag == name || t.Field(i).Name == name {
+				indexes = append(indexes, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown accesslog field %q", name)
+		}
 	}
+	return indexes, nil
+}
 
+func omitAccessLogFields(accessLog *AccessLog, indexes []int) {
+	if len(indexes) == 0 {
+		return
+	}
+	v := reflect.ValueOf(accessLog).Elem()
+	for _, i := range indexes {
+		f := v.Field(i)
+		f.Set(reflect.Zero(f.Type()))
+	}
+}
+
+// decodeBodyLog decodes a JSON body and redacts it.
+// Bodies that are truncated or not valid JSON are kept as a string, masked by Redactor.RedactText.
+func decodeBodyLog(body []byte, truncated bool, redactor *Redactor) interface{} {
+	if !truncated {
+		var v interface{}
+		d := json.NewDecoder(bytes.NewBuffer(body))
+		d.UseNumber()
+		if err := d.Decode(&v); err == nil {
+			return redactor.Redact(v)
+		}
+	}
+
+	s := redactor.RedactText(string(body))
+	if truncated {
+		s += "...(truncated)"
+	}
+	return s
+}
+
+func newAccessLog(req *http.Request) *AccessLog {
 	path := req.URL.Path
 	if path == "" {
 		path = "/"
@@ -151,23 +343,31 @@ func newAccessLog(req *http.Request) *AccessLog {
 		params[k] = v[0]
 	}
 
-	requestId := req.Header.Get(HeaderXRequestID)
+	requestId := RequestIDFromContext(req.Context())
+	if requestId == "" {
+		requestId = req.Header.Get(HeaderXRequestID)
+	}
 	if requestId == "" {
 		requestId = random.String(32)
 	}
+	actionId := ActionIDFromContext(req.Context())
+	if actionId == "" {
+		actionId = req.Header.Get(HeaderXActionID)
+	}
 
 	tokenInfo := GetTokenInfo(req.Header.Get(echo.HeaderAuthorization))
 
 	c := &AccessLog{
 		RequestID: requestId,
+		ActionID:  actionId,
 		SessionID: tokenInfo.SessionId,
 		UserId:    tokenInfo.UserId,
 
 		Timestamp:     time.Now(),
-		RemoteIP:      realIP,
 		Host:          req.Host,
 		Uri:           req.RequestURI,
 		Method:        req.Method,
+		Proto:         req.Proto,
 		Path:          path,
 		Params:        params,
 		Referer:       req.Referer(),
@@ -180,26 +380,6 @@ func newAccessLog(req *http.Request) *AccessLog {
 	return c
 }
 
-func shouldWriteBodyLog(req *http.Request, accessLog *AccessLog) bool {
-	if accessLog == nil {
-		return false
-	}
-	if req.Method != http.MethodPost &&
-		req.Method != http.MethodPut &&
-		req.Method != http.MethodPatch &&
-		req.Method != http.MethodDelete {
-		return false
-	}
-
-	contentType := req.Header.Get(echo.HeaderContentType)
-	if !strings.HasPrefix(strings.ToLower(contentType), echo.MIMEApplicationJSON) {
-		return false
-	}
-
-	return true
-
-}
-
 type echoRouter struct {
 	once   sync.Once
 	routes map[string]string
@@ -226,7 +406,7 @@ func (er *echoRouter) getControllerAndAction(c echo.Context) (controller, action
 	return
 }
 
-func (echoRouter) convertHandlerNameToControllerAndAction(handlerName string) (controller, action string) {
+func (*echoRouter) convertHandlerNameToControllerAndAction(handlerName string) (controller, action string) {
 	handlerSplitIndex := strings.LastIndex(handlerName, ".")
 	if handlerSplitIndex == -1 || handlerSplitIndex >= len(handlerName) {
 		controller, action = "", handlerName
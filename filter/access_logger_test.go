@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func serveAccessLog(t *testing.T, config AccessLoggerConfig, register func(e *echo.Echo), req *http.Request) (*AccessLog, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	writer := &recordAccessLogWriter{}
+	config.Writer = writer
+
+	e := echo.New()
+	e.Use(AccessLoggerWithConfig(config))
+	register(e)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	test.Equals(t, 1, writer.len())
+	return writer.accessLogs[0], rec
+}
+
+func TestAccessLoggerResponseCapture(t *testing.T) {
+	config := AccessLoggerConfig{
+		ResponseCapture: &ResponseCaptureConfig{Routes: []string{"* /partners/**"}, Statuses: []string{"2xx", "4xx"}, MaxSize: 64},
+	}
+	register := func(e *echo.Echo) {
+		e.GET("/partners/:id", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]interface{}{"id": c.Param("id"), "accessToken": "secret"})
+		})
+		e.GET("/partners/:id/large", func(c echo.Context) error {
+			return c.String(http.StatusOK, strings.Repeat("x", 100))
+		})
+		e.GET("/partners/:id/stream", func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c.Response().WriteHeader(http.StatusOK)
+			c.Response().Write([]byte(`{"a":`))
+			c.Response().Flush()
+			c.Response().Write([]byte(`1}`))
+			return nil
+		})
+		e.GET("/users/:id", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]interface{}{"id": c.Param("id")})
+		})
+	}
+
+	accessLog, rec := serveAccessLog(t, config, register, httptest.NewRequest(http.MethodGet, "/partners/1", nil))
+	test.Equals(t, http.StatusOK, rec.Code)
+	test.Equals(t, map[string]interface{}{"id": "1", "accessToken": "*"}, accessLog.ResponseBody)
+
+	config.ResponseCapture.ContentTypes = []string{echo.MIMETextPlain}
+	accessLog, _ = serveAccessLog(t, config, register, httptest.NewRequest(http.MethodGet, "/partners/1/large", nil))
+	test.Equals(t, strings.Repeat("x", 64)+"...(truncated)", accessLog.ResponseBody)
+
+	config.ResponseCapture.ContentTypes = nil
+	accessLog, rec = serveAccessLog(t, config, register, httptest.NewRequest(http.MethodGet, "/partners/1/stream", nil))
+	test.Equals(t, true, rec.Flushed)
+	test.Equals(t, `{"a":1}`, rec.Body.String())
+	test.Assert(t, accessLog.ResponseBody != nil, "streamed response must be captured")
+
+	accessLog, _ = serveAccessLog(t, config, register, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	test.Equals(t, nil, accessLog.ResponseBody)
+}
+
+func TestAccessLoggerRequestBody(t *testing.T) {
+	register := func(e *echo.Echo) {
+		e.POST("/bind", func(c echo.Context) error {
+			var v map[string]interface{}
+			return c.Bind(&v)
+		})
+		e.POST("/ignore", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		e.POST("/upload", func(c echo.Context) error {
+			_, err := c.MultipartForm()
+			return err
+		})
+	}
+	newRequest := func(path, contentType, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		return req
+	}
+
+	accessLog, _ := serveAccessLog(t, AccessLoggerConfig{}, register, newRequest("/bind", echo.MIMEApplicationJSON, `{"name":"kim","password":"p\"w"}`))
+	test.Equals(t, map[string]interface{}{"name": "kim", "password": "*"}, accessLog.Body)
+
+	accessLog, _ = serveAccessLog(t, AccessLoggerConfig{MaxBodySize: 10}, register, newRequest("/ignore", echo.MIMETextPlain, "hello world, hello"))
+	test.Equals(t, "hello worl...(truncated)", accessLog.Body)
+
+	accessLog, _ = serveAccessLog(t, AccessLoggerConfig{MaxBodySize: 40}, register, newRequest("/bind", echo.MIMEApplicationJSON, `{"name":"kim","access_token":"0123456789abcdef"}`))
+	test.Equals(t, `{"name":"kim","access_token":"*"...(truncated)`, accessLog.Body)
+
+	accessLog, _ = serveAccessLog(t, AccessLoggerConfig{}, register, newRequest("/ignore", echo.MIMETextPlain, "user=kim password=hunter2"))
+	test.Equals(t, "user=kim password=*", accessLog.Body)
+
+	accessLog, _ = serveAccessLog(t, AccessLoggerConfig{}, register, newRequest("/ignore", echo.MIMEApplicationForm, "name=kim&phone=01012345678&tag=a&tag=b"))
+	test.Equals(t, map[string]interface{}{"name": "kim", "phone": "*******5678", "tag": []interface{}{"a", "b"}}, accessLog.Body)
+
+	accessLog, _ = serveAccessLog(t, AccessLoggerConfig{}, register, newRequest("/ignore", echo.MIMEOctetStream, "\x00\x01"))
+	test.Equals(t, "(omitted application/octet-stream, 2 bytes)", accessLog.Body)
+
+	multipartBody := "--b\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nlogo\r\n" +
+		"--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"logo.png\"\r\nContent-Type: image/png\r\n\r\nPNG\r\n--b--\r\n"
+	accessLog, _ = serveAccessLog(t, AccessLoggerConfig{}, register, newRequest("/upload", "multipart/form-data; boundary=b", multipartBody))
+	test.Equals(t, map[string]interface{}{
+		"fields": map[string]interface{}{"title": "logo"},
+		"files":  []interface{}{map[string]interface{}{"field": "file", "filename": "logo.png", "size": int64(3), "content_type": "image/png"}},
+	}, accessLog.Body)
+}
+
+func TestAccessLoggerConfig(t *testing.T) {
+	config := AccessLoggerConfig{
+		Skipper: func(c echo.Context) bool { return c.Path() == "/health" },
+		Enrichers: []func(c echo.Context, accessLog *AccessLog){
+			func(c echo.Context, accessLog *AccessLog) { AddLogField(c, "version", "1.2.0") },
+		},
+		OmitFields: []string{"user_agent", "Hostname"},
+	}
+	register := func(e *echo.Echo) {
+		e.GET("/orders", func(c echo.Context) error {
+			AddLogField(c, "tenant", "acme")
+			return c.NoContent(http.StatusOK)
+		})
+	}
+
+	accessLog, _ := serveAccessLog(t, config, register, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	test.Equals(t, map[string]interface{}{"tenant": "acme", "version": "1.2.0"}, accessLog.Extra)
+	test.Equals(t, "", accessLog.UserAgent)
+	test.Equals(t, "", accessLog.Hostname)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?page=2&access_token=t", nil)
+	req.Header.Set("Referer", "https://shop.example.com/login?password=p")
+	accessLog, _ = serveAccessLog(t, config, register, req)
+	test.Equals(t, "/orders?page=2&access_token=*", accessLog.Uri)
+	test.Equals(t, "https://shop.example.com/login?password=*", accessLog.Referer)
+	test.Equals(t, map[string]interface{}{"page": "2", "access_token": "*"}, accessLog.Params)
+
+	req = httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, "1.1.1.1")
+	accessLog, _ = serveAccessLog(t, config, register, req)
+	test.Equals(t, "203.0.113.9", accessLog.RemoteIP)
+
+	writer := &recordAccessLogWriter{}
+	config.Writer = writer
+	e := echo.New()
+	e.Use(AccessLoggerWithConfig(config))
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	test.Equals(t, 0, writer.len())
+}
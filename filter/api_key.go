@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"fmt"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/jaehue/echo-kit/jwtutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderXAPIKey = "X-API-Key"
+
+type APIClient struct {
+	Key    string // value sent by the caller, or the key id for signed requests
+	Secret string // shared secret used by HMACSignature
+	Name   string
+	UserId int64
+	Role   string
+	Scopes []string
+}
+
+// APIKeyStore looks up the APIClient owning a key. It returns nil without error when the key does not exist.
+type APIKeyStore interface {
+	GetAPIKey(key string) (*APIClient, error)
+}
+
+type APIKeyStoreFunc func(key string) (*APIClient, error)
+
+func (f APIKeyStoreFunc) GetAPIKey(key string) (*APIClient, error) {
+	return f(key)
+}
+
+type memoryAPIKeyStore struct {
+	keys map[string]APIClient
+}
+
+func MemoryAPIKeyStore(keys ...APIClient) APIKeyStore {
+	s := &memoryAPIKeyStore{keys: make(map[string]APIClient)}
+	for _, k := range keys {
+		s.keys[k.Key] = k
+	}
+	return s
+}
+
+func (s *memoryAPIKeyStore) GetAPIKey(key string) (*APIClient, error) {
+	k, ok := s.keys[key]
+	if !ok {
+		return nil, nil
+	}
+	return &k, nil
+}
+
+type APIKeyConfig struct {
+	Ignore []string
+	Store  APIKeyStore
+	Header string   // default: X-API-Key
+	Scopes []string // scopes every key must have
+}
+
+func APIKey(config APIKeyConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("echo-kit: api key middleware requires a store")
+	}
+	if config.Header == "" {
+		config.Header = HeaderXAPIKey
+	}
+	skipper := ignoreSkipper(config.Ignore)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			key := c.Request().Header.Get(config.Header)
+			if key == "" {
+				return api.RenderFail(c, api.ErrorMissToken.New(fmt.Errorf("Missing %s header", config.Header)))
+			}
+
+			apiKey, err := lookupAPIKey(config.Store, key, config.Scopes)
+			if err != nil {
+				return api.RenderFail(c, err)
+			}
+
+			jwtutil.SetAuthInfo(c, apiKey.authInfo())
+			return next(c)
+		}
+	}
+}
+
+func lookupAPIKey(store APIKeyStore, key string, scopes []string) (*APIClient, error) {
+	apiKey, err := store.GetAPIKey(key)
+	if err != nil {
+		return nil, api.ErrorUnknown.New(err)
+	}
+	if apiKey == nil {
+		return nil, api.ErrorTokenInvaild.New(fmt.Errorf("Unknown api key"))
+	}
+	for _, scope := range scopes {
+		if !apiKey.HasScope(scope) {
+			return nil, api.ErrorPermissionDenied.New(fmt.Errorf("Api key %s has no scope %s", apiKey.Name, scope))
+		}
+	}
+	return apiKey, nil
+}
+
+func (k APIClient) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k APIClient) authInfo() jwtutil.AuthInfo {
+	// an api key has no session
+	return jwtutil.AuthInfo{
+		UserId: k.UserId,
+		Role:   k.Role,
+		Scopes: k.Scopes,
+	}
+}
@@ -0,0 +1,56 @@
+package filter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaehue/echo-kit/jwtutil"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestAPIKey(t *testing.T) {
+	store := MemoryAPIKeyStore(
+		APIClient{Key: "k-orders", Name: "partner", UserId: 7, Role: "partner", Scopes: []string{"orders"}},
+		APIClient{Key: "k-other", Name: "other", UserId: 8},
+	)
+
+	e := echo.New()
+	e.Use(APIKey(APIKeyConfig{Store: store, Scopes: []string{"orders"}, Ignore: []string{"GET /ping"}}))
+	e.GET("/orders", func(c echo.Context) error {
+		authInfo := jwtutil.GetAuthInfo(c)
+		return c.String(http.StatusOK, fmt.Sprintf("%d %s %q", authInfo.UserId, authInfo.Role, authInfo.SessionId))
+	})
+	e.GET("/ping", func(c echo.Context) error { return c.String(http.StatusOK, "pong") })
+
+	serve := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set(HeaderXAPIKey, key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		rec := serve("/orders", "k-orders")
+		test.Equals(t, http.StatusOK, rec.Code)
+		test.Equals(t, `7 partner ""`, rec.Body.String())
+	})
+	t.Run("missing", func(t *testing.T) {
+		test.Equals(t, http.StatusUnauthorized, serve("/orders", "").Code)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		test.Equals(t, http.StatusUnauthorized, serve("/orders", "k-unknown").Code)
+	})
+	t.Run("scope", func(t *testing.T) {
+		test.Equals(t, http.StatusForbidden, serve("/orders", "k-other").Code)
+	})
+	t.Run("ignored", func(t *testing.T) {
+		test.Equals(t, http.StatusOK, serve("/ping", "").Code)
+	})
+}
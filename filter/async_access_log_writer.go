@@ -0,0 +1,274 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BatchAccessLogWriter is implemented by writers that can write several entries at once.
+type BatchAccessLogWriter interface {
+	WriteBatch(accessLogs []*AccessLog)
+}
+
+type AsyncPolicy int
+
+const (
+	// AsyncDrop drops new entries while the queue is full.
+	AsyncDrop AsyncPolicy = iota
+	// AsyncBlock makes the request wait until the queue has room.
+	AsyncBlock
+	// AsyncSample keeps entries with an error or a 5xx status and one in SampleRate of the others while the queue is full,
+	// waiting for room like AsyncBlock, and drops the rest.
+	AsyncSample
+)
+
+type AsyncWriterOptions struct {
+	QueueSize     int           // default: 1024
+	BatchSize     int           // default: 100
+	FlushInterval time.Duration // default: 1 second
+	Workers       int           // default: 1
+	Policy        AsyncPolicy
+	SampleRate    int // used by AsyncSample, default: 10
+}
+
+type AsyncWriterStats struct {
+	Written uint64
+	Dropped uint64
+	Queued  int
+}
+
+type AsyncAccessLogWriter struct {
+	inner   AccessLogWriter
+	options AsyncWriterOptions
+
+	queue   chan *AccessLog
+	flushes []chan chan struct{}
+	done    chan struct{}
+
+	// the queue is closed once the writers blocked on it have given up
+	mutex   sync.RWMutex
+	closed  bool
+	closing chan struct{}
+	senders sync.WaitGroup
+
+	written uint64
+	dropped uint64
+	sampled uint64
+}
+
+// AsyncWriter writes access logs to inner from background workers,
+// so that a slow writer never adds latency to requests.
+// Call Close on shutdown to write the queued entries.
+func AsyncWriter(inner AccessLogWriter, options AsyncWriterOptions) *AsyncAccessLogWriter {
+	if inner == nil {
+		inner = &defaultAccessLogWriter{}
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 1024
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.SampleRate <= 0 {
+		options.SampleRate = 10
+	}
+
+	w := &AsyncAccessLogWriter{
+		inner:   inner,
+		options: options,
+		queue:   make(chan *AccessLog, options.QueueSize),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < options.Workers; i++ {
+		flush := make(chan chan struct{})
+		w.flushes = append(w.flushes, flush)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work(flush)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(w.done)
+	}()
+
+	return w
+}
+
+func (w *AsyncAccessLogWriter) Write(accessLog *AccessLog) {
+	w.mutex.RLock()
+	if w.closed {
+		w.mutex.RUnlock()
+		atomic.AddUint64(&w.dropped, 1)
+		return
+	}
+	w.senders.Add(1)
+	w.mutex.RUnlock()
+	defer w.senders.Done()
+
+	select {
+	case w.queue <- accessLog:
+		return
+	default:
+	}
+
+	switch w.options.Policy {
+	case AsyncBlock:
+		w.wait(accessLog)
+		return
+	case AsyncSample:
+		if IsError()(accessLog) || atomic.AddUint64(&w.sampled, 1)%uint64(w.options.SampleRate) == 0 {
+			w.wait(accessLog)
+			return
+		}
+	}
+	atomic.AddUint64(&w.dropped, 1)
+}
+
+// wait blocks until the queue has room or the writer is closed.
+func (w *AsyncAccessLogWriter) wait(accessLog *AccessLog) {
+	select {
+	case w.queue <- accessLog:
+	case <-w.closing:
+		atomic.AddUint64(&w.dropped, 1)
+	}
+}
+
+func (w *AsyncAccessLogWriter) Stats() AsyncWriterStats {
+	return AsyncWriterStats{
+		Written: atomic.LoadUint64(&w.written),
+		Dropped: atomic.LoadUint64(&w.dropped),
+		Queued:  len(w.queue),
+	}
+}
+
+func (w *AsyncAccessLogWriter) innerWriters() []AccessLogWriter {
+	return []AccessLogWriter{w.inner}
+}
+
+// Flush waits until every queued entry has been written to the inner writer.
+func (w *AsyncAccessLogWriter) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for len(w.queue) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	for _, flush := range w.flushes {
+		ack := make(chan struct{})
+		select {
+		case flush <- ack:
+		case <-w.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-ack:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close stops accepting entries, waits until the queued ones are written and closes the inner writer.
+// It gives up when ctx is done.
+func (w *AsyncAccessLogWriter) Close(ctx context.Context) error {
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.closing)
+		go func() {
+			w.senders.Wait()
+			close(w.queue)
+		}()
+	}
+	w.mutex.Unlock()
+
+	select {
+	case <-w.done:
+		return CloseAccessLogWriter(ctx, w.inner)
+	case <-ctx.Done():
+		return fmt.Errorf("Fail to write %d queued access logs: %w", len(w.queue), ctx.Err())
+	}
+}
+
+func (w *AsyncAccessLogWriter) work(flush chan chan struct{}) {
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*AccessLog, 0, w.options.BatchSize)
+	writeBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+		w.writeBatch(batch)
+		batch = make([]*AccessLog, 0, w.options.BatchSize)
+	}
+
+	for {
+		select {
+		case accessLog, ok := <-w.queue:
+			if !ok {
+				writeBatch()
+				return
+			}
+			batch = append(batch, accessLog)
+			if len(batch) >= w.options.BatchSize {
+				writeBatch()
+			}
+		case <-ticker.C:
+			writeBatch()
+		case ack := <-flush:
+			writeBatch()
+			close(ack)
+		}
+	}
+}
+
+func (w *AsyncAccessLogWriter) writeBatch(batch []*AccessLog) {
+	if batchWriter, ok := w.inner.(BatchAccessLogWriter); ok {
+		w.safely(len(batch), func() { batchWriter.WriteBatch(batch) })
+		return
+	}
+	for _, accessLog := range batch {
+		accessLog := accessLog
+		w.safely(1, func() { w.inner.Write(accessLog) })
+	}
+}
+
+// safely keeps the worker alive when the inner writer panics.
+func (w *AsyncAccessLogWriter) safely(n int, write func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&w.dropped, uint64(n))
+			logrus.WithField("panic", r).Error("Fail to write accesslog")
+		}
+	}()
+
+	write()
+	atomic.AddUint64(&w.written, uint64(n))
+}
@@ -0,0 +1,139 @@
+package filter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type recordAccessLogWriter struct {
+	mutex      sync.Mutex
+	accessLogs []*AccessLog
+}
+
+func (w *recordAccessLogWriter) Write(accessLog *AccessLog) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.accessLogs = append(w.accessLogs, accessLog)
+}
+
+func (w *recordAccessLogWriter) len() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.accessLogs)
+}
+
+// blockingAccessLogWriter signals started on every write and waits for release before recording it.
+type blockingAccessLogWriter struct {
+	recordAccessLogWriter
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingAccessLogWriter() *blockingAccessLogWriter {
+	return &blockingAccessLogWriter{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (w *blockingAccessLogWriter) Write(accessLog *AccessLog) {
+	w.started <- struct{}{}
+	<-w.release
+	w.recordAccessLogWriter.Write(accessLog)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	t.Run("flush-and-close", func(t *testing.T) {
+		inner := &recordAccessLogWriter{}
+		w := AsyncWriter(inner, AsyncWriterOptions{BatchSize: 7, FlushInterval: time.Hour, Workers: 3})
+		for i := 0; i < 100; i++ {
+			w.Write(&AccessLog{Status: 200})
+		}
+		test.Ok(t, w.Flush(context.Background()))
+		test.Equals(t, 100, inner.len())
+
+		w.Write(&AccessLog{Status: 200})
+		test.Ok(t, w.Close(context.Background()))
+		test.Equals(t, 101, inner.len())
+
+		w.Write(&AccessLog{Status: 200})
+		test.Equals(t, uint64(101), w.Stats().Written)
+		test.Equals(t, uint64(1), w.Stats().Dropped)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		inner := newBlockingAccessLogWriter()
+		w := AsyncWriter(inner, AsyncWriterOptions{QueueSize: 2, BatchSize: 1, Policy: AsyncDrop})
+		w.Write(&AccessLog{Status: 200})
+		<-inner.started
+
+		// the worker is blocked on the first entry and the queue holds two more
+		for i := 0; i < 49; i++ {
+			w.Write(&AccessLog{Status: 200})
+		}
+		test.Equals(t, uint64(47), w.Stats().Dropped)
+
+		close(inner.release)
+		test.Ok(t, w.Close(context.Background()))
+		test.Equals(t, uint64(3), w.Stats().Written)
+		test.Equals(t, 3, inner.len())
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		inner := newBlockingAccessLogWriter()
+		w := AsyncWriter(inner, AsyncWriterOptions{QueueSize: 1, BatchSize: 1, Policy: AsyncSample, SampleRate: 100})
+		w.Write(&AccessLog{Status: 200})
+		<-inner.started
+		w.Write(&AccessLog{Status: 200})
+		w.Write(&AccessLog{Status: 200})
+		test.Equals(t, uint64(1), w.Stats().Dropped)
+
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			w.Write(&AccessLog{Status: 503})
+		}()
+		close(inner.release)
+		<-written
+
+		test.Ok(t, w.Close(context.Background()))
+		test.Equals(t, 3, inner.len())
+		test.Equals(t, 503, inner.accessLogs[2].Status)
+	})
+
+	t.Run("close-deadline", func(t *testing.T) {
+		inner := newBlockingAccessLogWriter()
+		defer close(inner.release)
+		w := AsyncWriter(inner, AsyncWriterOptions{QueueSize: 10, BatchSize: 1})
+		for i := 0; i < 10; i++ {
+			w.Write(&AccessLog{Status: 200})
+		}
+		<-inner.started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		test.Assert(t, w.Close(ctx) != nil, "expected deadline error")
+	})
+	t.Run("close-while-blocked", func(t *testing.T) {
+		inner := newBlockingAccessLogWriter()
+		defer close(inner.release)
+		w := AsyncWriter(inner, AsyncWriterOptions{QueueSize: 1, BatchSize: 1, Policy: AsyncBlock})
+		w.Write(&AccessLog{Status: 200})
+		<-inner.started
+		w.Write(&AccessLog{Status: 200})
+
+		// the queue is full, so this write blocks until Close gives up on it
+		blocked := make(chan struct{})
+		go func() {
+			defer close(blocked)
+			w.Write(&AccessLog{Status: 200})
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		test.Assert(t, w.Close(ctx) != nil, "expected deadline error")
+		<-blocked
+		test.Equals(t, uint64(1), w.Stats().Dropped)
+	})
+}
@@ -17,8 +17,12 @@ func (w *defaultAccessLogWriter) Write(accessLog *AccessLog) {
 		"status":     accessLog.Status,
 		"error":      accessLog.Error,
 		"latency":    accessLog.Latency,
-		"bytes_in":   accessLog.BytesSent,
+		"bytes_in":   accessLog.RequestLength,
+		"bytes_out":  accessLog.BytesSent,
 	})
+	for k, v := range accessLog.Extra {
+		logEntry = logEntry.WithField(k, v)
+	}
 
 	if accessLog.Error == "" {
 		logEntry.Info("accesslog")
@@ -1,7 +1,8 @@
 package filter
 
 import (
-	"os"
+	"io"
+	"sync"
 
 	"github.com/fatih/structs"
 	"github.com/sirupsen/logrus"
@@ -9,9 +10,19 @@ import (
 
 type fileLogWriter struct {
 	logger *logrus.Logger
+	file   io.Closer
+
+	mutex  sync.RWMutex
+	closed bool
 }
 
 func (w *fileLogWriter) Write(accessLog *AccessLog) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if w.closed {
+		return
+	}
+
 	logEntry := w.logger.WithField("level", "")
 	for k, v := range structs.New(accessLog).Map() {
 		if k == "Id" || v == nil || v == int64(0) || v == "" {
@@ -20,6 +31,9 @@ func (w *fileLogWriter) Write(accessLog *AccessLog) {
 		if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
 			continue
 		}
+		if m, ok := v.(map[string]string); ok && len(m) == 0 {
+			continue
+		}
 
 		logEntry = logEntry.WithField(k, v)
 	}
@@ -30,18 +44,47 @@ func (w *fileLogWriter) Write(accessLog *AccessLog) {
 	}
 }
 
+// Close waits for in-flight writes and closes the file.
+func (w *fileLogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// FileLogWriter writes to filename, falling back to stderr when the file can not be opened.
+// Use NewFileLogWriter for rotation and to handle the error.
 func FileLogWriter(filename string) AccessLogWriter {
-	logger := logrus.New()
-	logger.Formatter = &logrus.JSONFormatter{}
+	w, err := NewFileLogWriter(filename, RotateOptions{})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to log to file, using default stderr")
 
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err == nil {
-		logger.Out = file
-	} else {
-		logger.Info("Failed to log to file, using default stderr")
+		logger := logrus.New()
+		logger.Formatter = &logrus.JSONFormatter{}
+		return &fileLogWriter{logger: logger}
+	}
+	return w
+}
+
+func NewFileLogWriter(filename string, options RotateOptions) (AccessLogWriter, error) {
+	file, err := openRotatingFile(filename, options)
+	if err != nil {
+		return nil, err
 	}
 
+	logger := logrus.New()
+	logger.Formatter = &logrus.JSONFormatter{}
+	logger.Out = file
+
 	return &fileLogWriter{
 		logger: logger,
-	}
+		file:   file,
+	}, nil
 }
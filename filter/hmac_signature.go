@@ -0,0 +1,156 @@
+package filter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/jaehue/echo-kit/jwtutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderXTimestamp = "X-Timestamp"
+	HeaderXSignature = "X-Signature"
+)
+
+type HMACSignatureConfig struct {
+	Ignore      []string
+	Store       APIKeyStore
+	KeyHeader   string        // default: X-API-Key
+	MaxSkew     time.Duration // default: 5 minutes
+	Scopes      []string
+	ReplayCache ReplayCache // default: in-memory cache
+	MaxBodySize int64       // larger bodies are rejected, default: 1MB
+}
+
+// ReplayCache remembers signatures until they expire.
+// Seen reports whether the signature was already used, and records it if not.
+type ReplayCache interface {
+	Seen(signature string, expiresAt time.Time) bool
+}
+
+// HMACSignature verifies requests signed with HMACSign.
+// The caller sends its key in X-API-Key, the unix time in X-Timestamp and the hex signature in X-Signature.
+func HMACSignature(config HMACSignatureConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("echo-kit: hmac signature middleware requires a store")
+	}
+	if config.KeyHeader == "" {
+		config.KeyHeader = HeaderXAPIKey
+	}
+	if config.MaxSkew == 0 {
+		config.MaxSkew = 5 * time.Minute
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1024 * 1024
+	}
+	if config.ReplayCache == nil {
+		config.ReplayCache = MemoryReplayCache()
+	}
+	skipper := ignoreSkipper(config.Ignore)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			key := req.Header.Get(config.KeyHeader)
+			timestamp := req.Header.Get(HeaderXTimestamp)
+			signature := req.Header.Get(HeaderXSignature)
+			if key == "" || timestamp == "" || signature == "" {
+				return api.RenderFail(c, api.ErrorMissToken.New(fmt.Errorf("Missing signature headers")))
+			}
+
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				return api.RenderFail(c, api.ErrorTokenInvaild.New(fmt.Errorf("Invalid timestamp %q", timestamp)))
+			}
+			signedAt := time.Unix(unix, 0)
+			if skew := time.Since(signedAt); skew > config.MaxSkew || skew < -config.MaxSkew {
+				return api.RenderFail(c, api.ErrorTokenInvaild.New(fmt.Errorf("Signature timestamp is out of range")))
+			}
+
+			apiKey, err := lookupAPIKey(config.Store, key, config.Scopes)
+			if err != nil {
+				return api.RenderFail(c, err)
+			}
+
+			var body []byte
+			if req.Body != nil {
+				body, err = io.ReadAll(io.LimitReader(req.Body, config.MaxBodySize+1))
+				req.Body.Close()
+				if err != nil {
+					return api.RenderFail(c, api.ErrorIllegalRequest.New(err))
+				}
+				if int64(len(body)) > config.MaxBodySize {
+					return api.RenderFail(c, api.ErrorIllegalRequest.New(fmt.Errorf("Request body is larger than %d bytes", config.MaxBodySize)))
+				}
+				req.Body = io.NopCloser(bytes.NewBuffer(body))
+			}
+
+			expected := HMACSign(apiKey.Secret, req.Method, req.URL.RequestURI(), timestamp, body)
+			if !hmac.Equal([]byte(expected), []byte(signature)) {
+				return api.RenderFail(c, api.ErrorTokenInvaild.New(fmt.Errorf("Signature mismatch")))
+			}
+
+			if config.ReplayCache.Seen(key+":"+signature, signedAt.Add(config.MaxSkew)) {
+				return api.RenderFail(c, api.ErrorTokenInvaild.New(fmt.Errorf("Signature already used")))
+			}
+
+			jwtutil.SetAuthInfo(c, apiKey.authInfo())
+			return next(c)
+		}
+	}
+}
+
+// HMACSign returns the hex encoded HMAC-SHA256 of
+// "METHOD\nPATH\nTIMESTAMP\nhex(sha256(body))" where PATH includes the query string.
+func HMACSign(secret, method, path, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type memoryReplayCache struct {
+	mutex     sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func MemoryReplayCache() ReplayCache {
+	return &memoryReplayCache{seen: make(map[string]time.Time)}
+}
+
+func (r *memoryReplayCache) Seen(signature string, expiresAt time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastPrune) > time.Minute {
+		for k, exp := range r.seen {
+			if now.After(exp) {
+				delete(r.seen, k)
+			}
+		}
+		r.lastPrune = now
+	}
+
+	if exp, ok := r.seen[signature]; ok && now.Before(exp) {
+		return true
+	}
+	r.seen[signature] = expiresAt
+	return false
+}
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaehue/echo-kit/jwtutil"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestHMACSignature(t *testing.T) {
+	store := MemoryAPIKeyStore(APIClient{Key: "partner", Secret: "s3cret", Name: "partner", UserId: 7, Scopes: []string{"orders"}})
+
+	e := echo.New()
+	e.Use(HMACSignature(HMACSignatureConfig{Store: store, Scopes: []string{"orders"}, Ignore: []string{"GET /ping"}}))
+	e.POST("/orders", func(c echo.Context) error {
+		return c.String(http.StatusOK, strconv.FormatInt(jwtutil.GetAuthInfo(c).UserId, 10))
+	})
+	e.GET("/ping", func(c echo.Context) error { return c.String(http.StatusOK, "pong") })
+
+	newRequest := func(secret string, timestamp time.Time) *http.Request {
+		body := `{"sku":"A-1"}`
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/orders?dry=1", strings.NewReader(body))
+		req.Header.Set(HeaderXAPIKey, "partner")
+		req.Header.Set(HeaderXTimestamp, ts)
+		req.Header.Set(HeaderXSignature, HMACSign(secret, http.MethodPost, "/orders?dry=1", ts, []byte(body)))
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		req := newRequest("s3cret", time.Now())
+		rec := serve(req)
+		test.Equals(t, http.StatusOK, rec.Code)
+		test.Equals(t, "7", rec.Body.String())
+
+		// the same signature can not be replayed
+		replay := httptest.NewRequest(http.MethodPost, "/orders?dry=1", strings.NewReader(`{"sku":"A-1"}`))
+		replay.Header = req.Header
+		test.Equals(t, http.StatusUnauthorized, serve(replay).Code)
+	})
+	t.Run("wrong-secret", func(t *testing.T) {
+		test.Equals(t, http.StatusUnauthorized, serve(newRequest("other", time.Now())).Code)
+	})
+	t.Run("expired", func(t *testing.T) {
+		test.Equals(t, http.StatusUnauthorized, serve(newRequest("s3cret", time.Now().Add(-time.Hour))).Code)
+	})
+	t.Run("ignored", func(t *testing.T) {
+		test.Equals(t, http.StatusOK, serve(httptest.NewRequest(http.MethodGet, "/ping", nil)).Code)
+	})
+	t.Run("too-large", func(t *testing.T) {
+		e := echo.New()
+		e.Use(HMACSignature(HMACSignatureConfig{Store: store, MaxBodySize: 4}))
+		e.POST("/orders", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newRequest("s3cret", time.Now()))
+		test.Equals(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,163 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jaehue/echo-kit/wildcard"
+)
+
+// IgnoreRules is a compiled list of ignore rules as used by JWTConfig.Ignore.
+//
+// A rule is "METHODS PATH":
+//   - METHODS is "*" or a comma separated list such as "GET,HEAD"
+//   - PATH starts with "/" and may be prefixed by a host pattern, e.g. "*.example.com/public/*"
+//   - a ":name" segment matches any single segment
+//   - "*", "?", "[a-z]" and "{a,b}" match within a single segment, "**" matches any number of segments
+//
+// A path with neither "**" nor ":name" segments, such as "/api/*", keeps the original meaning
+// whatever the methods and host: "*" and "?" also match "/", and "[", "{" and "\" are literal characters.
+// Paths are matched as sent, so "/health" matches neither "/health/" nor "//health".
+type IgnoreRules struct {
+	byMethod map[string][]*ignoreRuleGroup
+	any      []*ignoreRuleGroup
+}
+
+// ignoreRuleGroup holds the paths of the rules sharing a method and a host pattern,
+// compiled into a single set so that a request is tested against all of them in one pass.
+type ignoreRuleGroup struct {
+	host  *wildcard.Matcher // nil matches any host
+	paths *wildcard.Set
+}
+
+func CompileIgnoreRules(rules []string) (*IgnoreRules, error) {
+	type groupKey struct {
+		method, host string
+		legacy       bool
+	}
+	var keys []groupKey
+	paths := make(map[groupKey][]string)
+
+	for _, s := range rules {
+		methods, host, path, legacy, err := parseIgnoreRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ignore rule %q: %v", s, err)
+		}
+		for _, method := range methods {
+			key := groupKey{method, host, legacy}
+			if _, ok := paths[key]; !ok {
+				keys = append(keys, key)
+			}
+			paths[key] = append(paths[key], path)
+		}
+	}
+
+	r := &IgnoreRules{byMethod: make(map[string][]*ignoreRuleGroup)}
+	for _, key := range keys {
+		group := &ignoreRuleGroup{}
+		if key.host != "" {
+			host, err := wildcard.Compile(key.host, wildcard.CaseInsensitive())
+			if err != nil {
+				return nil, fmt.Errorf("Invalid ignore rule host %q: %v", key.host, err)
+			}
+			group.host = host
+		}
+		var opts []wildcard.Option
+		if !key.legacy {
+			opts = append(opts, wildcard.PathSeparator('/'))
+		}
+		set, err := wildcard.CompileSet(paths[key], opts...)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ignore rule path: %v", err)
+		}
+		group.paths = set
+
+		if key.method == "*" {
+			r.any = append(r.any, group)
+		} else {
+			r.byMethod[key.method] = append(r.byMethod[key.method], group)
+		}
+	}
+	return r, nil
+}
+
+func MustCompileIgnoreRules(rules []string) *IgnoreRules {
+	r, err := CompileIgnoreRules(rules)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *IgnoreRules) Match(req *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return matchIgnoreRuleGroups(r.byMethod[req.Method], host, req.URL.Path) ||
+		matchIgnoreRuleGroups(r.any, host, req.URL.Path)
+}
+
+func matchIgnoreRuleGroups(groups []*ignoreRuleGroup, host, path string) bool {
+	for _, group := range groups {
+		if group.host != nil && !group.host.Match(host) {
+			continue
+		}
+		if group.paths.MatchAny(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIgnoreRule translates a rule into its methods, host pattern and a path pattern for the wildcard package.
+// A legacy path is matched without path mode, as wildcard.Match did.
+func parseIgnoreRule(s string) (methods []string, host, path string, legacy bool, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return nil, "", "", false, fmt.Errorf("expected \"METHODS PATH\"")
+	}
+
+	for _, method := range strings.Split(fields[0], ",") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" {
+			return nil, "", "", false, fmt.Errorf("empty method")
+		}
+		methods = append(methods, method)
+	}
+
+	index := strings.Index(fields[1], "/")
+	if index == -1 {
+		return nil, "", "", false, fmt.Errorf("path must start with /")
+	}
+	host = fields[1][:index]
+
+	legacy = true
+	segments := strings.Split(fields[1][index:], "/")
+	for i, v := range segments {
+		switch {
+		case v == "**":
+			legacy = false
+		case strings.Contains(v, "**"):
+			return nil, "", "", false, fmt.Errorf("** must be a whole segment")
+		case strings.HasPrefix(v, ":"):
+			if len(v) == 1 {
+				return nil, "", "", false, fmt.Errorf("empty parameter name")
+			}
+			legacy = false
+			segments[i] = "?*"
+		}
+	}
+	path = strings.Join(segments, "/")
+	if legacy {
+		path = legacyPathEscaper.Replace(path)
+	}
+	return methods, host, path, legacy, nil
+}
+
+var legacyPathEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "{", `\{`)
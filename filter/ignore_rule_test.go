@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := CompileIgnoreRules([]string{
+		"* /health",
+		"GET,HEAD /public/*",
+		"GET /users/:id/avatar",
+		"POST /hooks/**/callback",
+		"GET *.example.com/docs/**",
+	})
+	test.Ok(t, err)
+
+	for _, c := range []struct {
+		method, target string
+		expected       bool
+	}{
+		{"DELETE", "/health", true},
+		{"GET", "/health/", false},
+		{"GET", "/health/../health", false},
+		{"HEAD", "/public/logo.png", true},
+		{"GET", "/public/img/logo.png", true},
+		{"POST", "/public/logo.png", false},
+		{"GET", "/users/10/avatar", true},
+		{"GET", "/users/10/orders", false},
+		{"POST", "/hooks/callback", true},
+		{"POST", "/hooks/a/b/callback", true},
+		{"GET", "http://api.example.com/docs/v1/index.html", true},
+		{"GET", "http://example.org/docs/index.html", false},
+	} {
+		req := httptest.NewRequest(c.method, c.target, nil)
+		test.Equals(t, c.expected, rules.Match(req))
+	}
+
+	t.Run("raw-path", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = "//health"
+		test.Equals(t, false, rules.Match(req))
+	})
+
+	t.Run("same-semantics", func(t *testing.T) {
+		for _, rule := range []string{"GET /public/*", "GET,HEAD /public/*", "* /public/*", "GET *.example.com/public/*"} {
+			rules, err := CompileIgnoreRules([]string{rule})
+			test.Ok(t, err)
+
+			req := httptest.NewRequest("GET", "http://api.example.com/public/img/logo.png", nil)
+			test.Equals(t, true, rules.Match(req))
+		}
+	})
+
+	for _, invalid := range []string{"GET", "GET public", "GET /a**", "GET /users/:"} {
+		_, err := CompileIgnoreRules([]string{invalid})
+		test.Assert(t, err != nil, "expected error for %q", invalid)
+	}
+
+	t.Run("legacy", func(t *testing.T) {
+		rules, err := CompileIgnoreRules([]string{
+			"GET /api/*",
+			"POST /v?/ping",
+			"GET /a?b",
+			"GET /files/[draft]{1}\\x",
+		})
+		test.Ok(t, err)
+
+		for _, c := range []struct {
+			method, target string
+			expected       bool
+		}{
+			{"GET", "/api/users", true},
+			{"GET", "/api/users/10/orders", true},
+			{"GET", "/apis", false},
+			{"POST", "/v1/ping", true},
+			{"POST", "/v12/ping", false},
+			{"GET", "/a/b", true},
+			{"GET", "/files/[draft]{1}%5Cx", true},
+			{"GET", "/files/d1x", false},
+		} {
+			req := httptest.NewRequest(c.method, c.target, nil)
+			test.Equals(t, c.expected, rules.Match(req))
+		}
+	})
+}
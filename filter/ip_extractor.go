@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderForwarded = "Forwarded"
+
+// TrustedProxyIPExtractor returns an echo.IPExtractor that only believes forwarding headers set by trusted proxies.
+// trustedProxies are IPs or CIDRs such as "10.0.0.0/8".
+//
+// When the peer is trusted, the RFC 7239 Forwarded header, or else X-Forwarded-For, is walked from the right
+// and the first address that is not a trusted proxy is the client. When that entry is "unknown" or
+// an obfuscated identifier, the proxy that reported it is returned instead. Set it as e.IPExtractor so that
+// the access logger, rate limiting and c.RealIP() agree on the client address.
+func TrustedProxyIPExtractor(trustedProxies ...string) (echo.IPExtractor, error) {
+	var nets []*net.IPNet
+	for _, s := range trustedProxies {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid trusted proxy %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %q: %v", s, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	trusted := func(s string) bool {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return false
+		}
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(req *http.Request) string {
+		remote, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			remote = req.RemoteAddr
+		}
+		if !trusted(remote) {
+			return remote
+		}
+
+		chain := forwardedFor(req.Header.Values(HeaderForwarded))
+		if len(chain) == 0 {
+			chain = forwardedFor(nil, req.Header.Values(HeaderXForwardedFor)...)
+		}
+		client := remote
+		for i := len(chain) - 1; i >= 0; i-- {
+			if trusted(chain[i]) {
+				client = chain[i]
+				continue
+			}
+			// "unknown" and obfuscated identifiers such as "_hidden" are no address,
+			// and the entries left of them are not vouched for, so keep the proxy that reported them
+			if net.ParseIP(chain[i]) != nil {
+				client = chain[i]
+			}
+			break
+		}
+		return client
+	}, nil
+}
+
+func MustTrustedProxyIPExtractor(trustedProxies ...string) echo.IPExtractor {
+	extractor, err := TrustedProxyIPExtractor(trustedProxies...)
+	if err != nil {
+		panic(err)
+	}
+	return extractor
+}
+
+// forwardedFor returns the "for" addresses of Forwarded header values,
+// or the addresses of X-Forwarded-For values, from the client to the last proxy.
+func forwardedFor(forwarded []string, xForwardedFor ...string) []string {
+	var chain []string
+	for _, header := range forwarded {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					chain = append(chain, normalizeForwardedIP(strings.Trim(kv[1], `"`)))
+				}
+			}
+		}
+	}
+	for _, header := range xForwardedFor {
+		for _, ip := range strings.Split(header, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				chain = append(chain, normalizeForwardedIP(ip))
+			}
+		}
+	}
+	return chain
+}
+
+// normalizeForwardedIP removes the port and IPv6 brackets, e.g. "[2001:db8::17]:4711" becomes "2001:db8::17".
+func normalizeForwardedIP(s string) string {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+}
@@ -0,0 +1,38 @@
+package filter
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestTrustedProxyIPExtractor(t *testing.T) {
+	extract := MustTrustedProxyIPExtractor("10.0.0.0/8", "192.0.2.1")
+
+	for _, c := range []struct {
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		// untrusted peers can not spoof their address
+		{"203.0.113.9:1234", map[string]string{HeaderXForwardedFor: "1.1.1.1"}, "203.0.113.9"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedFor: "1.1.1.1, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"192.0.2.1:1234", map[string]string{HeaderForwarded: `for=1.1.1.1, for="[2001:db8::17]:4711";proto=https`}, "2001:db8::17"},
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedFor: "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		// unknown and obfuscated clients fall back to the proxy that reported them
+		{"10.0.0.1:1234", map[string]string{HeaderForwarded: "for=1.1.1.1, for=unknown"}, "10.0.0.1"},
+		{"10.0.0.1:1234", map[string]string{HeaderForwarded: `for=1.1.1.1, for="_hidden", for=10.0.0.2`}, "10.0.0.2"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		test.Equals(t, c.expected, extract(req))
+	}
+
+	_, err := TrustedProxyIPExtractor("10.0.0.0/33")
+	test.Assert(t, err != nil, "expected invalid CIDR error")
+}
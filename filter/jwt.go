@@ -1,11 +1,8 @@
 package filter
 
 import (
-	"os"
-	"strings"
-
 	"github.com/jaehue/echo-kit/api"
-	"github.com/jaehue/echo-kit/wildcard"
+	"github.com/jaehue/echo-kit/jwtutil"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
@@ -13,30 +10,72 @@ import (
 )
 
 type JWTConfig struct {
+	// Ignore lists the requests that skip authentication, e.g. "GET,HEAD /public/**". See IgnoreRules.
 	Ignore []string
+
+	// TokenLookup is a comma separated list of "<source>:<name>" where source is header, query, cookie, param or form.
+	// A header source may end with the scheme prefix to cut, e.g. "header:Authorization:Token ".
+	// Default: "header:Authorization"
+	TokenLookup string
+	// AuthScheme is the scheme of the Authorization header. Default: "Bearer"
+	AuthScheme string
+
+	// SigningKey verifies tokens with a fixed key. It takes precedence over KeyProvider.
+	SigningKey interface{}
+	// KeyProvider supplies the key per token. Default: jwtutil.EnvKey("JWT_SECRET")
+	KeyProvider jwtutil.KeyProvider
+	// SigningMethod is the only algorithm accepted, e.g. "RS256".
+	// Default: the algorithms of the key type, see jwtutil.RequireSigningMethod
+	SigningMethod string
+	// Claims creates the claims a token is decoded into. Default: jwt.MapClaims
+	Claims func() jwt.Claims
+	// ContextKey is the key the parsed *jwt.Token is stored under. Default: "user"
+	ContextKey string
+
+	// SuccessHandler is called after a token is verified, before the next handler.
+	SuccessHandler func(c echo.Context)
+
+	// Optional lets requests without a token through, while requests with an invalid token are still rejected.
+	Optional bool
 }
 
 func JWT(config JWTConfig) echo.MiddlewareFunc {
+	keyProvider := config.KeyProvider
+	if config.SigningKey != nil {
+		keyProvider = jwtutil.StaticKey(config.SigningKey)
+	}
+	if keyProvider == nil {
+		keyProvider = jwtutil.EnvKey("JWT_SECRET")
+	}
+
 	return middleware.JWTWithConfig(middleware.JWTConfig{
-		SigningKey: []byte(os.Getenv("JWT_SECRET")),
-		Skipper: func(c echo.Context) bool {
-			reqMethod := c.Request().Method
-			reqPath := c.Request().URL.Path
-			for _, ignore := range config.Ignore {
-				ss := strings.Split(ignore, " ")
-				if len(ss) != 2 {
-					continue
-				}
-				ignoreMethod, ignorePath := ss[0], ss[1]
-				if ignoreMethod == reqMethod {
-					if wildcard.Match(ignorePath, reqPath) {
-						return true
-					}
+		Skipper:     ignoreSkipper(config.Ignore),
+		TokenLookup: config.TokenLookup,
+		AuthScheme:  config.AuthScheme,
+		ContextKey:  config.ContextKey,
+		ParseTokenFunc: func(auth string, c echo.Context) (interface{}, error) {
+			var claims jwt.Claims = jwt.MapClaims{}
+			if config.Claims != nil {
+				claims = config.Claims()
+			}
+			return jwtutil.ParseWithSigningMethod(auth, claims, config.SigningMethod, keyProvider)
+		},
+		SuccessHandler: func(c echo.Context) {
+			if token, ok := c.Get(contextKeyOrDefault(config.ContextKey)).(*jwt.Token); ok {
+				if authInfo, ok := jwtutil.AuthInfoFromToken(token); ok {
+					jwtutil.SetAuthInfo(c, authInfo)
 				}
 			}
-			return false
+			if config.SuccessHandler != nil {
+				config.SuccessHandler(c)
+			}
 		},
-		ErrorHandler: func(err error) error {
+		ContinueOnIgnoredError: config.Optional,
+		ErrorHandlerWithContext: func(err error, c echo.Context) error {
+			if config.Optional && err == middleware.ErrJWTMissing {
+				return nil
+			}
+
 			var apiError api.Error
 			switch err.(type) {
 			case *jwt.ValidationError, jwt.ValidationError:
@@ -44,7 +83,7 @@ func JWT(config JWTConfig) echo.MiddlewareFunc {
 			case *echo.HTTPError:
 				apiError = api.ErrorMissToken.New(err)
 			default:
-				apiError = api.ErrorMissToken.New(err)
+				apiError = api.ErrorTokenInvaild.New(err)
 			}
 
 			return &echo.HTTPError{
@@ -57,3 +96,10 @@ func JWT(config JWTConfig) echo.MiddlewareFunc {
 		},
 	})
 }
+
+func contextKeyOrDefault(key string) string {
+	if key == "" {
+		return "user"
+	}
+	return key
+}
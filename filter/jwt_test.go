@@ -0,0 +1,81 @@
+package filter
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.Ok(t, err)
+	hmacKey := []byte("secret")
+
+	sign := func(method jwt.SigningMethod, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, jwt.MapClaims{
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString(key)
+		test.Ok(t, err)
+		return token
+	}
+
+	serve := func(config JWTConfig, path, token string) int {
+		e := echo.New()
+		e.Use(JWT(config))
+		e.GET("/*", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("hmac", func(t *testing.T) {
+		config := JWTConfig{SigningKey: hmacKey}
+		test.Equals(t, http.StatusOK, serve(config, "/", sign(jwt.SigningMethodHS256, hmacKey)))
+		test.Equals(t, http.StatusUnauthorized, serve(config, "/", sign(jwt.SigningMethodHS256, []byte("other"))))
+	})
+	t.Run("rsa", func(t *testing.T) {
+		config := JWTConfig{SigningKey: &rsaKey.PublicKey}
+		test.Equals(t, http.StatusOK, serve(config, "/", sign(jwt.SigningMethodRS256, rsaKey)))
+		test.Equals(t, http.StatusOK, serve(config, "/", sign(jwt.SigningMethodRS512, rsaKey)))
+	})
+	t.Run("algorithm-confusion", func(t *testing.T) {
+		config := JWTConfig{SigningKey: &rsaKey.PublicKey}
+		test.Equals(t, http.StatusUnauthorized, serve(config, "/", sign(jwt.SigningMethodHS256, hmacKey)))
+	})
+	t.Run("signing-method", func(t *testing.T) {
+		config := JWTConfig{SigningKey: &rsaKey.PublicKey, SigningMethod: "RS256"}
+		test.Equals(t, http.StatusOK, serve(config, "/", sign(jwt.SigningMethodRS256, rsaKey)))
+		test.Equals(t, http.StatusUnauthorized, serve(config, "/", sign(jwt.SigningMethodRS512, rsaKey)))
+
+		for _, method := range []*jwt.SigningMethodHMAC{jwt.SigningMethodHS384, jwt.SigningMethodHS512} {
+			config := JWTConfig{SigningKey: hmacKey, SigningMethod: method.Alg()}
+			test.Equals(t, http.StatusOK, serve(config, "/", sign(method, hmacKey)))
+			test.Equals(t, http.StatusUnauthorized, serve(config, "/", sign(jwt.SigningMethodHS256, hmacKey)))
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		test.Equals(t, http.StatusBadRequest, serve(JWTConfig{SigningKey: hmacKey}, "/", ""))
+	})
+	t.Run("optional", func(t *testing.T) {
+		config := JWTConfig{SigningKey: hmacKey, Optional: true}
+		test.Equals(t, http.StatusOK, serve(config, "/", ""))
+		test.Equals(t, http.StatusUnauthorized, serve(config, "/", "invalid"))
+	})
+	t.Run("ignore", func(t *testing.T) {
+		config := JWTConfig{SigningKey: hmacKey, Ignore: []string{"GET /public/**"}}
+		test.Equals(t, http.StatusOK, serve(config, "/public/a/b", ""))
+		test.Equals(t, http.StatusBadRequest, serve(config, "/private", ""))
+	})
+}
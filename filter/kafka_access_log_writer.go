@@ -1,10 +1,12 @@
 package filter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"time"
+	"strconv"
+	"sync"
 
 	"github.com/Shopify/sarama"
 	"github.com/sirupsen/logrus"
@@ -13,67 +15,264 @@ import (
 type kafkaAccessLogWriter struct {
 	topic    string
 	producer *kafkaProducer
+	options  kafkaWriterOptions
+
+	// Close waits for the writes in progress, which give up once the producer is closing
+	mutex   sync.RWMutex
+	closed  bool
+	senders sync.WaitGroup
 }
 
-func KafkaAccessLogWriter(brokers []string, topic string) AccessLogWriter {
-	if len(brokers) == 0 || topic == "" {
-		return nil
-	}
+type kafkaWriterOptions struct {
+	key       func(accessLog *AccessLog) string
+	noHeaders bool
+	config    []func(c *sarama.Config) error
+	spool     *KafkaSpoolOptions
+}
+
+type KafkaWriterOption func(*kafkaWriterOptions)
+
+// KafkaKey keys the messages with key, so that the entries with the same key keep their order.
+// Entries with an empty key are spread over the partitions.
+func KafkaKey(key func(accessLog *AccessLog) string) KafkaWriterOption {
+	return func(o *kafkaWriterOptions) { o.key = key }
+}
 
-	producer, err := newKafkaProducer(brokers, topic, func(c *sarama.Config) {
-		c.Producer.RequiredAcks = sarama.WaitForLocal       // Only wait for the leader to ack
-		c.Producer.Flush.Frequency = 500 * time.Millisecond // Flush batches every 500ms
+func KafkaKeyBySessionID() KafkaWriterOption {
+	return KafkaKey(func(accessLog *AccessLog) string { return accessLog.SessionID })
+}
 
+func KafkaKeyByUserID() KafkaWriterOption {
+	return KafkaKey(func(accessLog *AccessLog) string {
+		if accessLog.UserId == 0 {
+			return ""
+		}
+		return strconv.FormatInt(accessLog.UserId, 10)
 	})
+}
+
+func KafkaKeyByRequestID() KafkaWriterOption {
+	return KafkaKey(func(accessLog *AccessLog) string { return accessLog.RequestID })
+}
+
+// KafkaPartitioner chooses the partitioner, e.g. sarama.NewRoundRobinPartitioner. Default: sarama.NewHashPartitioner
+func KafkaPartitioner(partitioner sarama.PartitionerConstructor) KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) { c.Producer.Partitioner = partitioner })
+}
+
+// KafkaHeaders sets whether messages carry the request_id and hostname record headers. Default: true
+func KafkaHeaders(enabled bool) KafkaWriterOption {
+	return func(o *kafkaWriterOptions) { o.noHeaders = !enabled }
+}
+
+// KafkaAccessLogWriter returns nil when the writer can not be created. Use NewKafkaAccessLogWriter to handle the error.
+func KafkaAccessLogWriter(brokers []string, topic string, options ...KafkaWriterOption) AccessLogWriter {
+	w, err := NewKafkaAccessLogWriter(brokers, topic, options...)
 	if err != nil {
 		logrus.WithError(err).Error("Fail to create kafka producer")
 		return nil
 	}
+	return w
+}
+
+// NewKafkaAccessLogWriter validates the options and connects to brokers.
+// By default it waits for the leader to ack and flushes every 500ms.
+func NewKafkaAccessLogWriter(brokers []string, topic string, options ...KafkaWriterOption) (AccessLogWriter, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("Kafka accesslog writer requires brokers")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("Kafka accesslog writer requires a topic")
+	}
+
+	var o kafkaWriterOptions
+	for _, option := range options {
+		option(&o)
+	}
+	config, err := o.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 
-	return &kafkaAccessLogWriter{
+	producer, err := newKafkaProducer(brokers, topic, config, o.spool)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to create kafka producer: %w", err)
+	}
+
+	w := &kafkaAccessLogWriter{
 		topic:    topic,
 		producer: producer,
+		options:  o,
+	}
+	if producer.spool != nil {
+		return &spooledKafkaAccessLogWriter{w}, nil
 	}
+	return w, nil
+}
+
+type spooledKafkaAccessLogWriter struct {
+	*kafkaAccessLogWriter
+}
+
+func (w *spooledKafkaAccessLogWriter) SpoolStats() KafkaSpoolStats {
+	return w.producer.spool.stats()
 }
 
 func (w *kafkaAccessLogWriter) Write(accessLog *AccessLog) {
+	w.mutex.RLock()
+	if w.closed {
+		w.mutex.RUnlock()
+		logrus.Error("Kafka accesslog writer is closed")
+		return
+	}
+	w.senders.Add(1)
+	w.mutex.RUnlock()
+	defer w.senders.Done()
+
 	if w.producer == nil {
 		logrus.Error("Kafka producer is nil")
 		return
 	}
 
-	if err := w.producer.Send(accessLog); err != nil {
+	msg, err := w.message(accessLog)
+	if err != nil {
+		logrus.WithError(err).Error("Fail to marshal accesslog")
+		return
+	}
+	if err := w.producer.SendMessage(msg); err != nil {
 		logrus.WithError(err).Error("Fail to send accesslog to kafka")
 		return
 	}
 }
 
+func (w *kafkaAccessLogWriter) message(accessLog *AccessLog) (*sarama.ProducerMessage, error) {
+	value, err := json.Marshal(accessLog)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:     w.topic,
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: accessLog.Timestamp,
+	}
+	if w.options.key != nil {
+		if key := w.options.key(accessLog); key != "" {
+			msg.Key = sarama.StringEncoder(key)
+		}
+	}
+	if !w.options.noHeaders {
+		for _, header := range [][2]string{{"request_id", accessLog.RequestID}, {"hostname", accessLog.Hostname}} {
+			if header[1] != "" {
+				msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(header[0]), Value: []byte(header[1])})
+			}
+		}
+	}
+	return msg, nil
+}
+
+// Close stops accepting entries and waits until the producer has delivered the buffered ones.
+func (w *kafkaAccessLogWriter) Close(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.producer != nil {
+		close(w.producer.closing)
+	}
+	w.mutex.Unlock()
+
+	if w.producer == nil {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		w.senders.Wait()
+		done <- w.producer.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 type kafkaProducer struct {
 	topic    string
 	producer sarama.AsyncProducer
+	spool    *kafkaSpool
+
+	// done is closed when the errors and successes of the producer are handled
+	done chan struct{}
+	// closing is closed when Close is called, to release the senders blocked on the input
+	closing chan struct{}
 }
 
-func newKafkaProducer(brokers []string, topic string, options ...func(*sarama.Config)) (*kafkaProducer, error) {
-	kafkaConfig := sarama.NewConfig()
-	for _, option := range options {
-		option(kafkaConfig)
+func newKafkaProducer(brokers []string, topic string, kafkaConfig *sarama.Config, spoolOptions *KafkaSpoolOptions) (*kafkaProducer, error) {
+	producer, err := sarama.NewAsyncProducer(brokers, kafkaConfig)
+	if err != nil {
+		return nil, err
 	}
 
-	producer, err := sarama.NewAsyncProducer(brokers, kafkaConfig)
+	p, err := startKafkaProducer(producer, topic, spoolOptions)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func startKafkaProducer(producer sarama.AsyncProducer, topic string, spoolOptions *KafkaSpoolOptions) (*kafkaProducer, error) {
+	p := &kafkaProducer{
+		topic:    topic,
+		producer: producer,
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+
+	if spoolOptions == nil {
+		go func() {
+			defer close(p.done)
+			for err := range producer.Errors() {
+				log.Printf("Failed to send log entry to kafka : %v\n", err)
+			}
+		}()
+		return p, nil
+	}
+
+	spool, err := newKafkaSpool(producer, topic, *spoolOptions)
 	if err != nil {
 		return nil, err
 	}
+	p.spool = spool
 
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
+		defer wg.Done()
 		for err := range producer.Errors() {
-			log.Printf("Failed to send log entry to kafka : %v\n", err)
+			spool.onError(err)
 		}
 	}()
-
-	return &kafkaProducer{
-		topic:    topic,
-		producer: producer,
-	}, nil
+	go func() {
+		defer wg.Done()
+		for msg := range producer.Successes() {
+			spool.onSuccess(msg)
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(p.done)
+	}()
+	return p, nil
 }
 
 func (p *kafkaProducer) Send(v interface{}) error {
@@ -123,6 +322,32 @@ func (p *kafkaProducer) SendWithKey(v interface{}, key string) error {
 	return nil
 }
 
+func (p *kafkaProducer) SendMessage(msg *sarama.ProducerMessage) error {
+	if p == nil || p.producer == nil {
+		return fmt.Errorf("Kafka producer is nil")
+	}
+
+	if p.spool != nil {
+		p.spool.send(msg, p.closing)
+		return nil
+	}
+	select {
+	case p.producer.Input() <- msg:
+		return nil
+	case <-p.closing:
+		return fmt.Errorf("Kafka producer is closed")
+	}
+}
+
+// Close stops the replay and closes the producer. The messages it fails to deliver are spooled.
 func (p *kafkaProducer) Close() error {
-	return p.producer.Close()
+	if p.spool == nil {
+		return p.producer.Close()
+	}
+
+	p.spool.stop()
+	// Close would take the errors from the spool
+	p.producer.AsyncClose()
+	<-p.done
+	return p.spool.close()
 }
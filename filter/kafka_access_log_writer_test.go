@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestKafkaAccessLogWriterMessage(t *testing.T) {
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	accessLog := &AccessLog{Timestamp: timestamp, RequestID: "req-1", SessionID: "session-1", UserId: 7, Hostname: "host-1"}
+
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		test.Equals(t, "accesslog", msg.Topic)
+		test.Equals(t, sarama.StringEncoder("7"), msg.Key)
+		test.Equals(t, timestamp, msg.Timestamp)
+		test.Equals(t, []sarama.RecordHeader{
+			{Key: []byte("request_id"), Value: []byte("req-1")},
+			{Key: []byte("hostname"), Value: []byte("host-1")},
+		}, msg.Headers)
+		return nil
+	})
+
+	var options kafkaWriterOptions
+	KafkaKeyByUserID()(&options)
+	p, err := startKafkaProducer(producer, "accesslog", nil)
+	test.Ok(t, err)
+	w := &kafkaAccessLogWriter{
+		topic:    "accesslog",
+		producer: p,
+		options:  options,
+	}
+	w.Write(accessLog)
+	<-producer.Successes()
+	test.Ok(t, w.Close(context.Background()))
+
+	KafkaKeyBySessionID()(&options)
+	KafkaHeaders(false)(&options)
+	w.options = options
+	msg, err := w.message(accessLog)
+	test.Ok(t, err)
+	test.Equals(t, sarama.StringEncoder("session-1"), msg.Key)
+	test.Equals(t, 0, len(msg.Headers))
+
+	msg, err = w.message(&AccessLog{})
+	test.Ok(t, err)
+	test.Assert(t, msg.Key == nil, "expected no key for an empty session")
+}
+
+// stuckProducer never takes a message, like a producer whose brokers are down and buffers are full.
+type stuckProducer struct {
+	sarama.AsyncProducer
+	input  chan *sarama.ProducerMessage
+	errors chan *sarama.ProducerError
+}
+
+func (p *stuckProducer) Input() chan<- *sarama.ProducerMessage { return p.input }
+func (p *stuckProducer) Errors() <-chan *sarama.ProducerError  { return p.errors }
+func (p *stuckProducer) Close() error {
+	close(p.errors)
+	return nil
+}
+
+func TestKafkaAccessLogWriterClose(t *testing.T) {
+	producer := &stuckProducer{input: make(chan *sarama.ProducerMessage), errors: make(chan *sarama.ProducerError)}
+	p, err := startKafkaProducer(producer, "accesslog", nil)
+	test.Ok(t, err)
+	w := &kafkaAccessLogWriter{topic: "accesslog", producer: p}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		w.Write(&AccessLog{})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	test.Ok(t, w.Close(ctx))
+	<-written
+
+	cancel()
+	w = &kafkaAccessLogWriter{topic: "accesslog", producer: p}
+	test.Equals(t, context.Canceled, w.Close(ctx))
+}
+
+func TestNewKafkaAccessLogWriterValidation(t *testing.T) {
+	for name, options := range map[string][]KafkaWriterOption{
+		"Version":    {KafkaVersion("not-a-version")},
+		"Idempotent": {KafkaVersion("0.10.2.0"), KafkaIdempotent()},
+		"SCRAM":      {KafkaSASLSCRAM(sarama.SASLTypePlaintext, "user", "password")},
+		"Config":     {KafkaFlushFrequency(-time.Second)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w, err := NewKafkaAccessLogWriter([]string{"localhost:9092"}, "accesslog", options...)
+			test.Assert(t, err != nil, "expected a validation error")
+			test.Assert(t, w == nil, "expected no writer")
+		})
+	}
+
+	_, err := NewKafkaAccessLogWriter(nil, "accesslog")
+	test.Assert(t, err != nil, "expected a missing brokers error")
+
+	var o kafkaWriterOptions
+	for _, option := range []KafkaWriterOption{
+		KafkaVersion("2.8.0"), KafkaIdempotent(), KafkaSASLSCRAM(sarama.SASLTypeSCRAMSHA512, "user", "password"),
+		KafkaCompression(sarama.CompressionZSTD), KafkaClientID("echo-kit"),
+	} {
+		option(&o)
+	}
+	config, err := o.saramaConfig()
+	test.Ok(t, err)
+	test.Equals(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	test.Equals(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	test.Equals(t, "echo-kit", config.ClientID)
+}
+
+func TestAccessLogWriterSpecKafka(t *testing.T) {
+	spec, err := ParseAccessLogWriterSpec([]byte(`{
+		"type": "kafka", "brokers": ["kafka-1:9093"], "topic": "accesslog",
+		"version": "2.8.0", "compression": "zstd", "idempotent": true,
+		"tls": {"server_name": "kafka.internal"},
+		"sasl": {"mechanism": "SCRAM-SHA-512", "user": "user", "password": "password"}
+	}`))
+	test.Ok(t, err)
+
+	options, err := spec.kafkaOptions()
+	test.Ok(t, err)
+	var o kafkaWriterOptions
+	for _, option := range options {
+		option(&o)
+	}
+	config, err := o.saramaConfig()
+	test.Ok(t, err)
+	test.Equals(t, sarama.V2_8_0_0, config.Version)
+	test.Equals(t, sarama.CompressionZSTD, config.Producer.Compression)
+	test.Equals(t, true, config.Producer.Idempotent)
+	test.Equals(t, true, config.Net.TLS.Enable)
+	test.Equals(t, "kafka.internal", config.Net.TLS.Config.ServerName)
+	test.Equals(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+
+	for _, invalid := range []AccessLogWriterSpec{
+		{Type: "kafka", Compression: "brotli"},
+		{Type: "kafka", SASL: &KafkaSASLSpec{Mechanism: "GSSAPI"}},
+		{Type: "kafka", TLS: &KafkaTLSSpec{CAFile: "not-found.pem"}},
+	} {
+		_, err := invalid.kafkaOptions()
+		test.Assert(t, err != nil, "expected an error for %+v", invalid)
+	}
+}
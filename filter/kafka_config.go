@@ -0,0 +1,139 @@
+package filter
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// KafkaConfig changes the sarama configuration directly, for the settings without an option.
+func KafkaConfig(f func(c *sarama.Config)) KafkaWriterOption {
+	return func(o *kafkaWriterOptions) {
+		o.config = append(o.config, func(c *sarama.Config) error {
+			f(c)
+			return nil
+		})
+	}
+}
+
+func KafkaClientID(clientID string) KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) { c.ClientID = clientID })
+}
+
+// KafkaVersion sets the broker version, e.g. "2.8.0". Record headers require 0.11 or later.
+func KafkaVersion(version string) KafkaWriterOption {
+	return func(o *kafkaWriterOptions) {
+		o.config = append(o.config, func(c *sarama.Config) error {
+			v, err := sarama.ParseKafkaVersion(version)
+			if err != nil {
+				return fmt.Errorf("Invalid kafka version %q: %w", version, err)
+			}
+			c.Version = v
+			return nil
+		})
+	}
+}
+
+func KafkaTLS(tlsConfig *tls.Config) KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) {
+		c.Net.TLS.Enable = true
+		c.Net.TLS.Config = tlsConfig
+	})
+}
+
+func KafkaSASLPlain(user, password string) KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) {
+		c.Net.SASL.Enable = true
+		c.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		c.Net.SASL.User = user
+		c.Net.SASL.Password = password
+	})
+}
+
+// KafkaSASLSCRAM authenticates with SCRAM, mechanism being sarama.SASLTypeSCRAMSHA256 or sarama.SASLTypeSCRAMSHA512.
+func KafkaSASLSCRAM(mechanism sarama.SASLMechanism, user, password string) KafkaWriterOption {
+	return func(o *kafkaWriterOptions) {
+		o.config = append(o.config, func(c *sarama.Config) error {
+			var hash scram.HashGeneratorFcn
+			switch mechanism {
+			case sarama.SASLTypeSCRAMSHA256:
+				hash = scram.SHA256
+			case sarama.SASLTypeSCRAMSHA512:
+				hash = scram.SHA512
+			default:
+				return fmt.Errorf("Invalid SCRAM mechanism %q", mechanism)
+			}
+			c.Net.SASL.Enable = true
+			c.Net.SASL.Mechanism = mechanism
+			c.Net.SASL.User = user
+			c.Net.SASL.Password = password
+			c.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: hash} }
+			return nil
+		})
+	}
+}
+
+func KafkaCompression(codec sarama.CompressionCodec) KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) { c.Producer.Compression = codec })
+}
+
+func KafkaRequiredAcks(acks sarama.RequiredAcks) KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) { c.Producer.RequiredAcks = acks })
+}
+
+func KafkaFlushFrequency(d time.Duration) KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) { c.Producer.Flush.Frequency = d })
+}
+
+// KafkaIdempotent enables the idempotent producer, which waits for all in-sync replicas
+// and requires kafka 0.11 or later.
+func KafkaIdempotent() KafkaWriterOption {
+	return KafkaConfig(func(c *sarama.Config) {
+		c.Producer.Idempotent = true
+		c.Producer.RequiredAcks = sarama.WaitForAll
+		c.Net.MaxOpenRequests = 1
+		if c.Producer.Retry.Max < 1 {
+			c.Producer.Retry.Max = 1
+		}
+	})
+}
+
+func (o *kafkaWriterOptions) saramaConfig() (*sarama.Config, error) {
+	c := sarama.NewConfig()
+	c.Producer.RequiredAcks = sarama.WaitForLocal       // Only wait for the leader to ack
+	c.Producer.Flush.Frequency = 500 * time.Millisecond // Flush batches every 500ms
+	for _, apply := range o.config {
+		if err := apply(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid kafka config: %w", err)
+	}
+	return c, nil
+}
+
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (s *scramClient) Begin(user, password, authzID string) error {
+	client, err := s.hash.NewClient(user, password, authzID)
+	if err != nil {
+		return err
+	}
+	s.conversation = client.NewConversation()
+	return nil
+}
+
+func (s *scramClient) Step(challenge string) (string, error) {
+	return s.conversation.Step(challenge)
+}
+
+func (s *scramClient) Done() bool {
+	return s.conversation.Done()
+}
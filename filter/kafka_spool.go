@@ -0,0 +1,746 @@
+package filter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+type KafkaSpoolOptions struct {
+	// Dir keeps the spooled messages across restarts.
+	Dir string
+	// MaxBytes caps the disk usage; the oldest segments are dropped beyond it. Default: 1GB
+	MaxBytes int64
+	// SegmentSize is the size of a segment file, the unit in which entries are dropped. Default: 16MB
+	SegmentSize int64
+	// RetryInterval is how often replay is tried while brokers fail. Default: 5 seconds
+	RetryInterval time.Duration
+	// BatchSize is the number of messages replayed at once. Default: 100
+	BatchSize int
+}
+
+type KafkaSpoolStats struct {
+	Depth     int           // number of spooled messages
+	Bytes     int64         // disk usage of the segments
+	OldestAge time.Duration // age of the oldest spooled message
+	Dropped   uint64        // messages dropped at MaxBytes
+}
+
+// SpooledAccessLogWriter is implemented by the kafka writer created with KafkaSpool.
+type SpooledAccessLogWriter interface {
+	AccessLogWriter
+	SpoolStats() KafkaSpoolStats
+}
+
+// AccessLogSpoolStats adds up the stats of the SpooledAccessLogWriters in the tree of w,
+// looking through the Async, Multi, Filter, Sample and Route writers.
+// It returns false when there is none.
+func AccessLogSpoolStats(w AccessLogWriter) (KafkaSpoolStats, bool) {
+	switch w := w.(type) {
+	case SpooledAccessLogWriter:
+		return w.SpoolStats(), true
+	case wrappingAccessLogWriter:
+		var (
+			total KafkaSpoolStats
+			found bool
+		)
+		for _, inner := range w.innerWriters() {
+			stats, ok := AccessLogSpoolStats(inner)
+			if !ok {
+				continue
+			}
+			found = true
+			total.Depth += stats.Depth
+			total.Bytes += stats.Bytes
+			total.Dropped += stats.Dropped
+			if stats.OldestAge > total.OldestAge {
+				total.OldestAge = stats.OldestAge
+			}
+		}
+		return total, found
+	}
+	return KafkaSpoolStats{}, false
+}
+
+// wrappingAccessLogWriter is implemented by the writers that write to other writers.
+type wrappingAccessLogWriter interface {
+	innerWriters() []AccessLogWriter
+}
+
+// KafkaSpool writes the messages kafka fails to deliver to a segment log in options.Dir,
+// and replays them in order when the brokers are back.
+// From the first failure, new entries are spooled behind the failed ones instead of being sent,
+// and the replay waits for the messages in flight, so that the spool keeps their order.
+// A message sent before a failure may still be delivered ahead of an older one that failed.
+//
+// While spooling, every Write syncs a segment to disk under a lock shared by all requests,
+// so put the writer behind AsyncWriter to keep the outage off the request path.
+func KafkaSpool(options KafkaSpoolOptions) KafkaWriterOption {
+	return func(o *kafkaWriterOptions) {
+		o.spool = &options
+		o.config = append(o.config, func(c *sarama.Config) error {
+			// the first success after a failure starts the replay
+			c.Producer.Return.Successes = true
+			return nil
+		})
+	}
+}
+
+type kafkaSpool struct {
+	disk     *diskSpool
+	topic    string
+	producer sarama.AsyncProducer
+	options  KafkaSpoolOptions
+
+	// spooling lasts from a failure until the spool is empty and no message sent live is in flight
+	mutex    sync.Mutex
+	spooling bool
+	inflight int
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type spoolReplay struct {
+	result chan error
+}
+
+type spooledMessage struct {
+	Key       []byte                `json:"key,omitempty"`
+	Value     []byte                `json:"value"`
+	Headers   []sarama.RecordHeader `json:"headers,omitempty"`
+	Timestamp time.Time             `json:"timestamp"`
+	SpooledAt time.Time             `json:"spooledAt"`
+}
+
+func newKafkaSpool(producer sarama.AsyncProducer, topic string, options KafkaSpoolOptions) (*kafkaSpool, error) {
+	if options.Dir == "" {
+		return nil, fmt.Errorf("Kafka spool requires a directory")
+	}
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = 1024 * 1024 * 1024
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = 16 * 1024 * 1024
+	}
+	if options.SegmentSize > options.MaxBytes/2 {
+		options.SegmentSize = options.MaxBytes / 2
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = 5 * time.Second
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+
+	disk, err := openDiskSpool(options.Dir, options.MaxBytes, options.SegmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &kafkaSpool{
+		disk:     disk,
+		topic:    topic,
+		producer: producer,
+		options:  options,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.replay()
+	return s, nil
+}
+
+// send spools msg while spooling, and otherwise sends it.
+// It spools msg as well when the producer starts closing before taking it.
+func (s *kafkaSpool) send(msg *sarama.ProducerMessage, closing <-chan struct{}) {
+	s.mutex.Lock()
+	live := !s.spooling && s.disk.depth() == 0
+	if live {
+		s.inflight++
+	} else {
+		s.spool(msg)
+	}
+	s.mutex.Unlock()
+	if !live {
+		return
+	}
+
+	select {
+	case s.producer.Input() <- msg:
+	case <-closing:
+		s.fail(msg)
+	}
+}
+
+// fail spools a message sent live, and spools the following ones behind it.
+func (s *kafkaSpool) fail(msg *sarama.ProducerMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inflight--
+	s.spooling = true
+	s.spool(msg)
+}
+
+func (s *kafkaSpool) spool(msg *sarama.ProducerMessage) {
+	m := spooledMessage{Timestamp: msg.Timestamp, Headers: msg.Headers, SpooledAt: time.Now()}
+	var err error
+	if msg.Key != nil {
+		if m.Key, err = msg.Key.Encode(); err != nil {
+			logrus.WithError(err).Error("Fail to spool kafka message")
+			return
+		}
+	}
+	if m.Value, err = msg.Value.Encode(); err != nil {
+		logrus.WithError(err).Error("Fail to spool kafka message")
+		return
+	}
+
+	record, err := json.Marshal(m)
+	if err == nil {
+		err = s.disk.append(record)
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Fail to spool kafka message")
+	}
+}
+
+// onError spools the failed message, or reports the failure of a replayed one.
+func (s *kafkaSpool) onError(err *sarama.ProducerError) {
+	if replay, ok := err.Msg.Metadata.(*spoolReplay); ok {
+		replay.result <- err.Err
+		return
+	}
+	s.fail(err.Msg)
+}
+
+func (s *kafkaSpool) onSuccess(msg *sarama.ProducerMessage) {
+	if replay, ok := msg.Metadata.(*spoolReplay); ok {
+		replay.result <- nil
+		return
+	}
+
+	s.mutex.Lock()
+	s.inflight--
+	wake := s.spooling && s.inflight == 0
+	s.mutex.Unlock()
+	if wake {
+		s.wakeUp()
+	}
+}
+
+func (s *kafkaSpool) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *kafkaSpool) replay() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.options.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		for s.replayBatch() {
+		}
+	}
+}
+
+// replayBatch sends the oldest spooled messages and removes them once all are delivered.
+// It returns false when there is nothing to replay, messages sent live are still in flight, or the delivery failed.
+func (s *kafkaSpool) replayBatch() bool {
+	s.mutex.Lock()
+	inflight := s.inflight
+	s.mutex.Unlock()
+	if inflight > 0 {
+		// a message in flight may fail and be spooled behind the others
+		return false
+	}
+
+	records, end, err := s.disk.peek(s.options.BatchSize)
+	if err != nil {
+		logrus.WithError(err).Error("Fail to read kafka spool")
+		return false
+	}
+	if len(records) == 0 {
+		s.endSpooling()
+		return false
+	}
+
+	replay := &spoolReplay{result: make(chan error, len(records))}
+	for _, record := range records {
+		var m spooledMessage
+		if err := json.Unmarshal(record, &m); err != nil {
+			logrus.WithError(err).Error("Fail to decode spooled kafka message")
+			replay.result <- nil
+			continue
+		}
+		msg := &sarama.ProducerMessage{
+			Topic:     s.topic,
+			Value:     sarama.ByteEncoder(m.Value),
+			Headers:   m.Headers,
+			Timestamp: m.Timestamp,
+			Metadata:  replay,
+		}
+		if m.Key != nil {
+			msg.Key = sarama.ByteEncoder(m.Key)
+		}
+		select {
+		case s.producer.Input() <- msg:
+		case <-s.done:
+			return false
+		}
+	}
+
+	var failed error
+	for range records {
+		select {
+		case err := <-replay.result:
+			if err != nil && failed == nil {
+				failed = err
+			}
+		case <-s.done:
+			return false
+		}
+	}
+	if failed != nil {
+		// delivered messages are sent again on the next try
+		return false
+	}
+	if err := s.disk.commit(end); err != nil {
+		logrus.WithError(err).Error("Fail to commit kafka spool")
+		return false
+	}
+	s.endSpooling()
+	return true
+}
+
+// endSpooling sends new messages live again once the spool is empty.
+func (s *kafkaSpool) endSpooling() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.disk.depth() == 0 && s.inflight == 0 {
+		s.spooling = false
+	}
+}
+
+// stop ends the replay. Call close once the producer is closed and its errors are spooled.
+func (s *kafkaSpool) stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *kafkaSpool) close() error {
+	return s.disk.close()
+}
+
+func (s *kafkaSpool) stats() KafkaSpoolStats {
+	return s.disk.stats()
+}
+
+const (
+	spoolSegmentExt = ".seg"
+	spoolAckFile    = "ack"
+	spoolFrameSize  = 8 // length and crc32 of a record
+)
+
+// diskSpool is an append-only log of records split in segment files, read from the head.
+// The read position is kept in the ack file, so that committed records are not replayed after a restart.
+type diskSpool struct {
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+
+	mutex    sync.Mutex
+	segments []*spoolSegment
+	tail     *os.File
+	// position of the next record to read in segments[0]
+	headOffset int64
+	headIndex  int
+	oldest     time.Time
+	dropped    uint64
+}
+
+type spoolSegment struct {
+	seq     uint64
+	size    int64
+	records int
+}
+
+// spoolPosition is the position after a record.
+type spoolPosition struct {
+	seq    uint64
+	offset int64
+	index  int
+}
+
+func openDiskSpool(dir string, maxBytes, segmentSize int64) (*diskSpool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &diskSpool{dir: dir, maxBytes: maxBytes, segmentSize: segmentSize}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segment := &spoolSegment{seq: seq}
+		if err := s.scan(segment); err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, segment)
+	}
+
+	ack, err := s.readAck()
+	if err != nil {
+		return nil, err
+	}
+	for len(s.segments) > 0 && s.segments[0].seq < ack.seq {
+		if err := os.Remove(s.path(s.segments[0].seq)); err != nil {
+			return nil, err
+		}
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) > 0 && s.segments[0].seq == ack.seq && ack.index <= s.segments[0].records {
+		s.headOffset, s.headIndex = ack.offset, ack.index
+	}
+	if err := s.removeConsumedHead(); err != nil {
+		return nil, err
+	}
+	s.updateOldest()
+	return s, nil
+}
+
+func (s *diskSpool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// scan counts the records of a segment, cutting a record torn by a crash.
+func (s *diskSpool) scan(segment *spoolSegment) error {
+	f, err := os.OpenFile(s.path(segment.seq), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	for {
+		_, n, err := readSpoolRecord(f, offset, s.segmentSize)
+		if err != nil {
+			break
+		}
+		offset += n
+		segment.records++
+	}
+	segment.size = offset
+	return f.Truncate(offset)
+}
+
+// readSpoolRecord reads the record at offset. A length over maxLength is taken for corruption,
+// so that a damaged frame can not make it allocate up to 4GB.
+func readSpoolRecord(r io.ReaderAt, offset, maxLength int64) ([]byte, int64, error) {
+	var frame [spoolFrameSize]byte
+	if _, err := r.ReadAt(frame[:], offset); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(frame[:4])
+	if int64(length) > maxLength {
+		return nil, 0, fmt.Errorf("Corrupt kafka spool record at %d: length %d exceeds %d", offset, length, maxLength)
+	}
+	record := make([]byte, length)
+	if _, err := r.ReadAt(record, offset+spoolFrameSize); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(frame[4:]) {
+		return nil, 0, fmt.Errorf("Corrupt kafka spool record at %d", offset)
+	}
+	return record, spoolFrameSize + int64(length), nil
+}
+
+func (s *diskSpool) append(record []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if int64(len(record)) > s.segmentSize {
+		return fmt.Errorf("Kafka spool record of %d bytes exceeds the segment size %d", len(record), s.segmentSize)
+	}
+	frame := make([]byte, spoolFrameSize+len(record))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(record))
+	copy(frame[spoolFrameSize:], record)
+
+	if s.tail == nil {
+		if err := s.openTail(); err != nil {
+			return err
+		}
+	}
+	if tail := s.segments[len(s.segments)-1]; tail.size > 0 && tail.size+int64(len(frame)) > s.segmentSize {
+		if err := s.tail.Close(); err != nil {
+			return err
+		}
+		s.tail = nil
+		if err := s.openSegment(tail.seq + 1); err != nil {
+			return err
+		}
+	}
+	if _, err := s.tail.Write(frame); err != nil {
+		return err
+	}
+	if err := s.tail.Sync(); err != nil {
+		return err
+	}
+
+	tail := s.segments[len(s.segments)-1]
+	tail.size += int64(len(frame))
+	tail.records++
+	if s.oldest.IsZero() {
+		s.oldest = time.Now()
+	}
+	return s.enforceMaxBytes()
+}
+
+// openTail continues the last segment, or starts a segment after the last committed one.
+func (s *diskSpool) openTail() error {
+	if n := len(s.segments); n > 0 {
+		f, err := os.OpenFile(s.path(s.segments[n-1].seq), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.tail = f
+		return nil
+	}
+
+	ack, err := s.readAck()
+	if err != nil {
+		return err
+	}
+	return s.openSegment(ack.seq + 1)
+}
+
+func (s *diskSpool) openSegment(seq uint64) error {
+	f, err := os.OpenFile(s.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, &spoolSegment{seq: seq})
+	s.tail = f
+	return nil
+}
+
+// enforceMaxBytes drops the oldest segments, never the one being written.
+func (s *diskSpool) enforceMaxBytes() error {
+	for len(s.segments) > 1 && s.bytes() > s.maxBytes {
+		head := s.segments[0]
+		s.dropped += uint64(head.records - s.headIndex)
+		if err := os.Remove(s.path(head.seq)); err != nil {
+			return err
+		}
+		s.segments = s.segments[1:]
+		s.headOffset, s.headIndex = 0, 0
+		s.updateOldest()
+	}
+	return nil
+}
+
+// peek reads up to n records from the head and returns the position after them.
+func (s *diskSpool) peek(n int) ([][]byte, spoolPosition, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var records [][]byte
+	var end spoolPosition
+	offset, index := s.headOffset, s.headIndex
+	for _, segment := range s.segments {
+		if index >= segment.records {
+			offset, index = 0, 0
+			continue
+		}
+		f, err := os.Open(s.path(segment.seq))
+		if err != nil {
+			return nil, end, err
+		}
+		for ; index < segment.records && len(records) < n; index++ {
+			record, size, err := readSpoolRecord(f, offset, s.segmentSize)
+			if err != nil {
+				f.Close()
+				return nil, end, err
+			}
+			records = append(records, record)
+			offset += size
+			end = spoolPosition{seq: segment.seq, offset: offset, index: index + 1}
+		}
+		f.Close()
+		if len(records) == n {
+			break
+		}
+		offset, index = 0, 0
+	}
+	return records, end, nil
+}
+
+// commit removes the records before end. The records dropped meanwhile are skipped.
+func (s *diskSpool) commit(end spoolPosition) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.segments) > 0 && s.segments[0].seq < end.seq {
+		if err := s.removeHead(); err != nil {
+			return err
+		}
+	}
+	if len(s.segments) == 0 || s.segments[0].seq != end.seq || end.index <= s.headIndex {
+		return nil
+	}
+	s.headOffset, s.headIndex = end.offset, end.index
+	if err := s.removeConsumedHead(); err != nil {
+		return err
+	}
+	s.updateOldest()
+	return s.writeAck(spoolPosition{seq: end.seq, offset: s.headOffset, index: s.headIndex})
+}
+
+func (s *diskSpool) removeHead() error {
+	head := s.segments[0]
+	if len(s.segments) == 1 && s.tail != nil {
+		if err := s.tail.Close(); err != nil {
+			return err
+		}
+		s.tail = nil
+	}
+	if err := os.Remove(s.path(head.seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.segments = s.segments[1:]
+	s.headOffset, s.headIndex = 0, 0
+	return nil
+}
+
+func (s *diskSpool) removeConsumedHead() error {
+	for len(s.segments) > 0 && s.headIndex >= s.segments[0].records {
+		seq := s.segments[0].seq
+		if err := s.removeHead(); err != nil {
+			return err
+		}
+		// keeps the sequence growing when the spool is empty
+		if err := s.writeAck(spoolPosition{seq: seq}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *diskSpool) updateOldest() {
+	s.oldest = time.Time{}
+	if len(s.segments) == 0 {
+		return
+	}
+	f, err := os.Open(s.path(s.segments[0].seq))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	record, _, err := readSpoolRecord(f, s.headOffset, s.segmentSize)
+	if err != nil {
+		return
+	}
+	var m spooledMessage
+	if json.Unmarshal(record, &m) == nil {
+		s.oldest = m.SpooledAt
+	}
+}
+
+func (s *diskSpool) readAck() (spoolPosition, error) {
+	var ack spoolPosition
+	b, err := os.ReadFile(filepath.Join(s.dir, spoolAckFile))
+	if os.IsNotExist(err) {
+		return ack, nil
+	}
+	if err != nil {
+		return ack, err
+	}
+	if _, err := fmt.Sscan(string(b), &ack.seq, &ack.offset, &ack.index); err != nil {
+		return spoolPosition{}, nil
+	}
+	return ack, nil
+}
+
+func (s *diskSpool) writeAck(ack spoolPosition) error {
+	name := filepath.Join(s.dir, spoolAckFile)
+	if err := os.WriteFile(name+".tmp", []byte(fmt.Sprintf("%d %d %d\n", ack.seq, ack.offset, ack.index)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+func (s *diskSpool) bytes() int64 {
+	var bytes int64
+	for _, segment := range s.segments {
+		bytes += segment.size
+	}
+	return bytes
+}
+
+func (s *diskSpool) depth() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.depthLocked()
+}
+
+func (s *diskSpool) depthLocked() int {
+	depth := -s.headIndex
+	for _, segment := range s.segments {
+		depth += segment.records
+	}
+	if depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+func (s *diskSpool) stats() KafkaSpoolStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := KafkaSpoolStats{Depth: s.depthLocked(), Bytes: s.bytes(), Dropped: s.dropped}
+	if !s.oldest.IsZero() {
+		stats.OldestAge = time.Since(s.oldest)
+	}
+	return stats
+}
+
+func (s *diskSpool) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.tail == nil {
+		return nil
+	}
+	err := s.tail.Close()
+	s.tail = nil
+	return err
+}
@@ -0,0 +1,155 @@
+package filter
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestDiskSpool(t *testing.T) {
+	dir := t.TempDir()
+	// a fixed time keeps the records the same size
+	spooledAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	record := func(i int) []byte {
+		b, _ := json.Marshal(spooledMessage{Value: []byte(fmt.Sprint(i)), SpooledAt: spooledAt})
+		return b
+	}
+	size := int64(spoolFrameSize + len(record(0)))
+	for i := 1; i < 9; i++ {
+		test.Equals(t, len(record(0)), len(record(i)))
+	}
+
+	// two records a segment, at most three segments
+	s, err := openDiskSpool(dir, 6*size, 2*size)
+	test.Ok(t, err)
+	for i := 0; i < 8; i++ {
+		test.Ok(t, s.append(record(i)))
+	}
+	stats := s.stats()
+	test.Equals(t, 6, stats.Depth)
+	test.Equals(t, uint64(2), stats.Dropped)
+	test.Assert(t, stats.OldestAge > 0, "expected the age of the oldest record")
+
+	records, end, err := s.peek(3)
+	test.Ok(t, err)
+	test.Equals(t, 3, len(records))
+	test.Equals(t, record(2)[:20], records[0][:20])
+	test.Ok(t, s.commit(end))
+	test.Equals(t, 3, s.depth())
+	test.Ok(t, s.close())
+
+	// the committed records are not read again
+	s, err = openDiskSpool(dir, 6*size, 2*size)
+	test.Ok(t, err)
+	test.Equals(t, 3, s.depth())
+	records, end, err = s.peek(10)
+	test.Ok(t, err)
+	var m spooledMessage
+	test.Ok(t, json.Unmarshal(records[0], &m))
+	test.Equals(t, "5", string(m.Value))
+	test.Ok(t, s.commit(end))
+	test.Equals(t, 0, s.depth())
+
+	// the sequence keeps growing once the spool is empty
+	test.Ok(t, s.append(record(8)))
+	test.Equals(t, uint64(5), s.segments[0].seq)
+	test.Assert(t, s.append(make([]byte, 3*size)) != nil, "expected a record over the segment size to fail")
+	test.Ok(t, s.close())
+
+	// a frame claiming a huge length is cut instead of being allocated
+	f, err := os.OpenFile(s.path(5), os.O_WRONLY|os.O_APPEND, 0644)
+	test.Ok(t, err)
+	var frame [spoolFrameSize]byte
+	binary.BigEndian.PutUint32(frame[:4], 0xfffffff0)
+	_, err = f.Write(frame[:])
+	test.Ok(t, err)
+	test.Ok(t, f.Close())
+
+	s, err = openDiskSpool(dir, 6*size, 2*size)
+	test.Ok(t, err)
+	test.Equals(t, 1, s.depth())
+	test.Equals(t, size, s.bytes())
+	test.Ok(t, s.close())
+}
+
+func TestKafkaAccessLogWriterSpool(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+
+	p, err := startKafkaProducer(producer, "accesslog", &KafkaSpoolOptions{Dir: t.TempDir(), RetryInterval: time.Hour})
+	test.Ok(t, err)
+	w := &spooledKafkaAccessLogWriter{&kafkaAccessLogWriter{topic: "accesslog", producer: p}}
+
+	waitDepth := func(depth int) {
+		t.Helper()
+		for i := 0; i < 100 && w.SpoolStats().Depth != depth; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		test.Equals(t, depth, w.SpoolStats().Depth)
+	}
+
+	// the brokers are down
+	producer.ExpectInputAndFail(errors.New("kafka: client has run out of available brokers"))
+	w.Write(&AccessLog{RequestID: "1"})
+	waitDepth(1)
+	// spooled behind the failed entry, without being sent
+	w.Write(&AccessLog{RequestID: "2"})
+	waitDepth(2)
+
+	// the brokers are back
+	var replayed []string
+	for i := 0; i < 2; i++ {
+		producer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			test.Equals(t, "accesslog", msg.Topic)
+			value, _ := msg.Value.Encode()
+			var accessLog AccessLog
+			if err := json.Unmarshal(value, &accessLog); err != nil {
+				return err
+			}
+			replayed = append(replayed, accessLog.RequestID)
+			return nil
+		})
+	}
+	p.spool.wakeUp()
+	waitDepth(0)
+	test.Equals(t, []string{"1", "2"}, replayed)
+
+	// sent live again once the spool is empty
+	producer.ExpectInputAndSucceed()
+	w.Write(&AccessLog{RequestID: "3"})
+	test.Equals(t, 0, w.SpoolStats().Depth)
+
+	test.Ok(t, w.Close(context.Background()))
+}
+
+type stubSpooledWriter struct {
+	recordAccessLogWriter
+	stats KafkaSpoolStats
+}
+
+func (w *stubSpooledWriter) SpoolStats() KafkaSpoolStats { return w.stats }
+
+func TestAccessLogSpoolStats(t *testing.T) {
+	a := &stubSpooledWriter{stats: KafkaSpoolStats{Depth: 1, Bytes: 10, OldestAge: time.Minute}}
+	b := &stubSpooledWriter{stats: KafkaSpoolStats{Depth: 2, Bytes: 20, OldestAge: time.Second, Dropped: 3}}
+
+	async := AsyncWriter(a, AsyncWriterOptions{})
+	defer async.Close(context.Background())
+	w := Multi(async, Route(func(*AccessLog) AccessLogWriter { return b }, Filter(IsError(), b)))
+	stats, ok := AccessLogSpoolStats(w)
+	test.Equals(t, true, ok)
+	test.Equals(t, KafkaSpoolStats{Depth: 3, Bytes: 30, OldestAge: time.Minute, Dropped: 3}, stats)
+
+	_, ok = AccessLogSpoolStats(Multi(&recordAccessLogWriter{}))
+	test.Equals(t, false, ok)
+}
@@ -0,0 +1,260 @@
+package filter
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/jaehue/echo-kit/jwtutil"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const loggerContextKey = "logger"
+
+type LoggerConfig struct {
+	Skipper middleware.Skipper
+	Logger  *logrus.Logger // default: logrus.StandardLogger()
+	Handler slog.Handler   // default: slog.Default().Handler()
+	// Buffered holds back the request's log lines and writes them only when the handler returns an error
+	// or the status is 5xx. The output of Logger is wrapped so that flushed lines and the lines of
+	// Logger itself are written one at a time.
+	Buffered bool
+	// BufferSize is the number of lines kept in Buffered mode; the oldest are dropped. Default: 100
+	BufferSize int
+}
+
+type requestLogger struct {
+	logger     *logrus.Logger
+	handler    slog.Handler
+	controller string
+	action     string
+}
+
+func RequestLogger() echo.MiddlewareFunc {
+	return RequestLoggerWithConfig(LoggerConfig{})
+}
+
+// RequestLoggerWithConfig binds the loggers returned by Logger and SlogLogger to the request.
+func RequestLoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Logger == nil {
+		config.Logger = logrus.StandardLogger()
+	}
+	if config.Handler == nil {
+		config.Handler = slog.Default().Handler()
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 100
+	}
+	if config.Buffered {
+		if _, ok := config.Logger.Out.(*lockedWriter); !ok {
+			config.Logger.SetOutput(&lockedWriter{out: config.Logger.Out})
+		}
+	}
+
+	var echoRouter echoRouter
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			rl := &requestLogger{logger: config.Logger, handler: config.Handler}
+			rl.controller, rl.action = echoRouter.getControllerAndAction(c)
+
+			var buffer *logBuffer
+			if config.Buffered {
+				buffer = &logBuffer{max: config.BufferSize}
+				rl.logger = bufferedLogrusLogger(config.Logger, buffer)
+				rl.handler = &bufferedSlogHandler{handler: config.Handler, buffer: buffer}
+			}
+			c.Set(loggerContextKey, rl)
+
+			err := next(c)
+			if buffer != nil && (err != nil || responseStatus(c, err) >= 500) {
+				buffer.flush()
+			}
+			return err
+		}
+	}
+}
+
+// Logger returns a logrus entry with the request_id, session_id, user_id, controller and action of the request,
+// so that handler logs can be joined with the access log.
+func Logger(c echo.Context) *logrus.Entry {
+	logger := logrus.StandardLogger()
+	if rl, ok := c.Get(loggerContextKey).(*requestLogger); ok {
+		logger = rl.logger
+	}
+	return logger.WithContext(c.Request().Context()).WithFields(logrus.Fields(requestLogFields(c)))
+}
+
+// SlogLogger is Logger for log/slog.
+func SlogLogger(c echo.Context) *slog.Logger {
+	handler := slog.Default().Handler()
+	if rl, ok := c.Get(loggerContextKey).(*requestLogger); ok {
+		handler = rl.handler
+	}
+
+	fields := requestLogFields(c)
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, k := range requestLogFieldNames {
+		if v, ok := fields[k]; ok {
+			args = append(args, k, v)
+		}
+	}
+	return slog.New(handler).With(args...)
+}
+
+var requestLogFieldNames = []string{"request_id", "session_id", "user_id", "controller", "action", "trace_id"}
+
+func requestLogFields(c echo.Context) map[string]interface{} {
+	fields := map[string]interface{}{}
+	req := c.Request()
+
+	requestID := RequestIDFromContext(req.Context())
+	if accessLog, ok := c.Get(accessLogContextKey).(*AccessLog); ok && requestID == "" {
+		requestID = accessLog.RequestID
+	}
+	if requestID == "" {
+		requestID = req.Header.Get(HeaderXRequestID)
+	}
+	if requestID != "" {
+		fields["request_id"] = requestID
+	}
+
+	if authInfo, ok := jwtutil.GetVerifiedAuthInfo(c); ok {
+		if authInfo.SessionId != "" {
+			fields["session_id"] = authInfo.SessionId
+		}
+		if authInfo.UserId != 0 {
+			fields["user_id"] = authInfo.UserId
+		}
+	}
+
+	controller, _ := c.Get("controller").(string)
+	action, _ := c.Get("action").(string)
+	if rl, ok := c.Get(loggerContextKey).(*requestLogger); ok {
+		if controller == "" {
+			controller = rl.controller
+		}
+		if action == "" {
+			action = rl.action
+		}
+	}
+	if controller != "" {
+		fields["controller"] = controller
+	}
+	if action != "" {
+		fields["action"] = action
+	}
+
+	if spanContext := trace.SpanContextFromContext(req.Context()); spanContext.IsValid() {
+		fields["trace_id"] = spanContext.TraceID().String()
+	}
+	return fields
+}
+
+// logBuffer keeps the last max log lines of a request until flush.
+type logBuffer struct {
+	mutex   sync.Mutex
+	max     int
+	lines   []func()
+	flushed bool
+}
+
+func (b *logBuffer) add(line func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.flushed {
+		line()
+		return
+	}
+	if len(b.lines) == b.max {
+		b.lines = b.lines[1:]
+	}
+	b.lines = append(b.lines, line)
+}
+
+// flush writes the buffered lines, and the lines logged later are written directly.
+func (b *logBuffer) flush() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, line := range b.lines {
+		line()
+	}
+	b.lines = nil
+	b.flushed = true
+}
+
+// bufferedLogrusLogger copies logger with its output replaced by buffer.
+// Hooks still fire when an entry is logged, whether or not the buffer is flushed.
+func bufferedLogrusLogger(logger *logrus.Logger, buffer *logBuffer) *logrus.Logger {
+	hooks := make(logrus.LevelHooks, len(logger.Hooks))
+	for level, levelHooks := range logger.Hooks {
+		hooks[level] = append([]logrus.Hook(nil), levelHooks...)
+	}
+	return &logrus.Logger{
+		Out:          &logrusBufferWriter{buffer: buffer, out: logger.Out},
+		Hooks:        hooks,
+		Formatter:    logger.Formatter,
+		ReportCaller: logger.ReportCaller,
+		Level:        logger.GetLevel(),
+		ExitFunc:     logger.ExitFunc,
+		BufferPool:   logger.BufferPool,
+	}
+}
+
+// lockedWriter serializes the writes of a logrus logger and of the buffers flushed into its output,
+// as logrus only locks the writes of the logger itself.
+type lockedWriter struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.out.Write(p)
+}
+
+type logrusBufferWriter struct {
+	buffer *logBuffer
+	out    io.Writer
+}
+
+func (w *logrusBufferWriter) Write(p []byte) (int, error) {
+	line := append([]byte(nil), p...)
+	w.buffer.add(func() { w.out.Write(line) })
+	return len(p), nil
+}
+
+type bufferedSlogHandler struct {
+	handler slog.Handler
+	buffer  *logBuffer
+}
+
+func (h *bufferedSlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *bufferedSlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	record = record.Clone()
+	h.buffer.add(func() { h.handler.Handle(context.WithoutCancel(ctx), record) })
+	return nil
+}
+
+func (h *bufferedSlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &bufferedSlogHandler{handler: h.handler.WithAttrs(attrs), buffer: h.buffer}
+}
+
+func (h *bufferedSlogHandler) WithGroup(name string) slog.Handler {
+	return &bufferedSlogHandler{handler: h.handler.WithGroup(name), buffer: h.buffer}
+}
@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogger(t *testing.T) {
+	var logrusOut, slogOut bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &logrusOut
+	logger.Formatter = &logrus.JSONFormatter{}
+	handler := slog.NewJSONHandler(&slogOut, nil)
+
+	newEcho := func(buffered bool) *echo.Echo {
+		e := echo.New()
+		e.Use(RequestID(), RequestLoggerWithConfig(LoggerConfig{Logger: logger, Handler: handler, Buffered: buffered}))
+		e.GET("/orders/:id", func(c echo.Context) error {
+			Logger(c).Info("logrus line")
+			SlogLogger(c).Info("slog line")
+			if c.Param("id") == "fail" {
+				return errors.New("fail")
+			}
+			return c.NoContent(http.StatusOK)
+		})
+		return e
+	}
+	serve := func(e *echo.Echo, path string) {
+		logrusOut.Reset()
+		slogOut.Reset()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(HeaderXRequestID, "req-1")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("Fields", func(t *testing.T) {
+		serve(newEcho(false), "/orders/1")
+		test.Assert(t, strings.Contains(logrusOut.String(), `"request_id":"req-1"`), logrusOut.String())
+		test.Assert(t, strings.Contains(slogOut.String(), `"request_id":"req-1"`), slogOut.String())
+	})
+
+	t.Run("Buffered", func(t *testing.T) {
+		hook := &logrustest.Hook{}
+		logger.AddHook(hook)
+		logger.ReportCaller = true
+		defer func() {
+			logger.ReplaceHooks(make(logrus.LevelHooks))
+			logger.ReportCaller = false
+		}()
+
+		e := newEcho(true)
+		serve(e, "/orders/1")
+		test.Equals(t, "", logrusOut.String())
+		test.Equals(t, "", slogOut.String())
+		test.Equals(t, 1, len(hook.AllEntries()))
+
+		serve(e, "/orders/fail")
+		test.Assert(t, strings.Contains(logrusOut.String(), "logrus line"), logrusOut.String())
+		test.Assert(t, strings.Contains(logrusOut.String(), `"func":`), "caller must be reported: %s", logrusOut.String())
+		test.Assert(t, strings.Contains(slogOut.String(), "slog line"), slogOut.String())
+	})
+
+	t.Run("BufferedConcurrent", func(t *testing.T) {
+		e := newEcho(true)
+		logrusOut.Reset()
+		slogOut.Reset()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/fail", nil))
+			}()
+			go func() {
+				defer wg.Done()
+				logger.Info("main line")
+			}()
+		}
+		wg.Wait()
+
+		lines := strings.Split(strings.TrimSpace(logrusOut.String()), "\n")
+		test.Equals(t, 20, len(lines))
+	})
+}
@@ -0,0 +1,196 @@
+package filter
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const unmatchedRoute = "unmatched"
+
+type MetricsConfig struct {
+	Skipper    middleware.Skipper
+	Registerer prometheus.Registerer // default: prometheus.DefaultRegisterer
+	Namespace  string
+	Subsystem  string
+	// LatencyBuckets in seconds, default: prometheus.DefBuckets
+	LatencyBuckets []float64
+	// SizeBuckets in bytes, default: 100B to 10MB
+	SizeBuckets []float64
+}
+
+type requestMetrics struct {
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	inFlight     *prometheus.GaugeVec
+}
+
+func Metrics() echo.MiddlewareFunc {
+	return MetricsWithConfig(MetricsConfig{})
+}
+
+// MetricsWithConfig records request counts, latencies and sizes by controller, action, method, status class
+// and api.Error code. Requests that match no route are counted under the "unmatched" controller.
+// Serve the metrics with MetricsHandler.
+func MetricsWithConfig(config MetricsConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if len(config.LatencyBuckets) == 0 {
+		config.LatencyBuckets = prometheus.DefBuckets
+	}
+	if len(config.SizeBuckets) == 0 {
+		config.SizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
+	}
+
+	metrics, err := newRequestMetrics(config)
+	if err != nil {
+		panic(err)
+	}
+
+	var echoRouter echoRouter
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			method := metricsMethod(req.Method)
+			controller, action := metricsRoute(&echoRouter, c)
+
+			inFlight := metrics.inFlight.WithLabelValues(controller, action, method)
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			start := time.Now()
+			err := next(c)
+			latency := time.Since(start)
+
+			// the handler may name itself with c.Set("controller") and c.Set("action")
+			controller, action = metricsRoute(&echoRouter, c)
+			status := responseStatus(c, err)
+			code := ""
+			var apiError api.Error
+			if errors.As(err, &apiError) {
+				code = strconv.Itoa(apiError.Code)
+			}
+
+			labels := []string{controller, action, method, statusClass(status), code}
+			metrics.requests.WithLabelValues(labels...).Inc()
+			metrics.latency.WithLabelValues(labels...).Observe(latency.Seconds())
+			metrics.requestSize.WithLabelValues(labels...).Observe(float64(max(req.ContentLength, 0)))
+			metrics.responseSize.WithLabelValues(labels...).Observe(float64(c.Response().Size))
+			return err
+		}
+	}
+}
+
+// MetricsHandler serves the metrics of gatherers, default: prometheus.DefaultGatherer.
+//
+//	e.GET("/metrics", filter.MetricsHandler())
+func MetricsHandler(gatherers ...prometheus.Gatherer) echo.HandlerFunc {
+	if len(gatherers) == 0 {
+		return echo.WrapHandler(promhttp.Handler())
+	}
+	return echo.WrapHandler(promhttp.HandlerFor(prometheus.Gatherers(gatherers), promhttp.HandlerOpts{}))
+}
+
+func newRequestMetrics(config MetricsConfig) (*requestMetrics, error) {
+	labels := []string{"controller", "action", "method", "status", "code"}
+	m := &requestMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: "http_requests_total", Help: "Number of HTTP requests.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: "http_request_duration_seconds", Help: "Latency of HTTP requests.",
+			Buckets: config.LatencyBuckets,
+		}, labels),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: "http_request_size_bytes", Help: "Size of HTTP request bodies.",
+			Buckets: config.SizeBuckets,
+		}, labels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: "http_response_size_bytes", Help: "Size of HTTP response bodies.",
+			Buckets: config.SizeBuckets,
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: config.Namespace, Subsystem: config.Subsystem,
+			Name: "http_requests_in_flight", Help: "Number of HTTP requests being served.",
+		}, []string{"controller", "action", "method"}),
+	}
+
+	var err error
+	if m.requests, err = registerCollector(config.Registerer, m.requests); err != nil {
+		return nil, err
+	}
+	if m.latency, err = registerCollector(config.Registerer, m.latency); err != nil {
+		return nil, err
+	}
+	if m.requestSize, err = registerCollector(config.Registerer, m.requestSize); err != nil {
+		return nil, err
+	}
+	if m.responseSize, err = registerCollector(config.Registerer, m.responseSize); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = registerCollector(config.Registerer, m.inFlight); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// registerCollector reuses the collector already registered by another Metrics middleware.
+func registerCollector[T prometheus.Collector](registerer prometheus.Registerer, collector T) (T, error) {
+	if err := registerer.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(T); ok {
+				return existing, nil
+			}
+		}
+		return collector, err
+	}
+	return collector, nil
+}
+
+func metricsRoute(er *echoRouter, c echo.Context) (controller, action string) {
+	controller, action = er.getControllerAndAction(c)
+	if controller == "" && action == "" {
+		return unmatchedRoute, ""
+	}
+	return
+}
+
+// metricsMethod collapses non-standard methods, which clients can make up freely.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,49 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	e := echo.New()
+	e.Use(MetricsWithConfig(MetricsConfig{Registerer: registry}))
+	e.GET("/orders/:id", (&traceTestController{}).GetOne)
+	e.DELETE("/orders/:id", (&traceTestController{}).Delete)
+	e.GET("/metrics", MetricsHandler(registry))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/orders/1", nil),
+		httptest.NewRequest(http.MethodGet, "/orders/2", nil),
+		httptest.NewRequest(http.MethodDelete, "/orders/1", nil),
+		httptest.NewRequest(http.MethodGet, "/no/such/path/1", nil),
+		httptest.NewRequest(http.MethodGet, "/no/such/path/2", nil),
+	} {
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		`http_requests_total{action="GetOne",code="",controller="traceTestController",method="GET",status="2xx"} 2`,
+		`http_requests_total{action="Delete",code="10005",controller="traceTestController",method="DELETE",status="4xx"} 1`,
+		`http_requests_total{action="",code="",controller="unmatched",method="GET",status="4xx"} 2`,
+		`http_requests_in_flight{action="GetOne",controller="traceTestController",method="GET"} 0`,
+		`http_request_duration_seconds_count{action="GetOne",code="",controller="traceTestController",method="GET",status="2xx"} 2`,
+	} {
+		test.Assert(t, strings.Contains(body, line), "expected %s", line)
+	}
+
+	// a second middleware shares the registered collectors
+	MetricsWithConfig(MetricsConfig{Registerer: registry})
+}
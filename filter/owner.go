@@ -0,0 +1,30 @@
+package filter
+
+import (
+	"strconv"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/jaehue/echo-kit/jwtutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Owner only lets the request through when the verified caller is the user
+// identified by the path parameter paramName, or has one of the given roles.
+//
+//	g := e.Group("/users/:userId", filter.Owner("userId", "admin"))
+func Owner(paramName string, roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ownerId, err := strconv.ParseInt(c.Param(paramName), 10, 64)
+			if err != nil {
+				return api.RenderFail(c, api.ErrorParameterParsingFailed.New(err, paramName))
+			}
+
+			if err := jwtutil.RequireSelfOrRole(c, ownerId, roles...); err != nil {
+				return api.RenderFail(c, err)
+			}
+			return next(c)
+		}
+	}
+}
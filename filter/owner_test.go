@@ -0,0 +1,53 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaehue/echo-kit/jwtutil"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestOwner(t *testing.T) {
+	serve := func(authInfo *jwtutil.AuthInfo, path string) int {
+		e := echo.New()
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				if authInfo != nil {
+					jwtutil.SetAuthInfo(c, *authInfo)
+				}
+				return next(c)
+			}
+		})
+		e.GET("/users/:userId", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		}, Owner("userId", "admin"))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	t.Run("owner", func(t *testing.T) {
+		test.Equals(t, http.StatusOK, serve(&jwtutil.AuthInfo{UserId: 7}, "/users/7"))
+	})
+	t.Run("other-user", func(t *testing.T) {
+		test.Equals(t, http.StatusForbidden, serve(&jwtutil.AuthInfo{UserId: 8}, "/users/7"))
+	})
+	t.Run("role", func(t *testing.T) {
+		test.Equals(t, http.StatusOK, serve(&jwtutil.AuthInfo{UserId: 8, Role: "admin"}, "/users/7"))
+	})
+	t.Run("no-identity", func(t *testing.T) {
+		test.Equals(t, http.StatusForbidden, serve(nil, "/users/7"))
+	})
+	t.Run("invalid-param", func(t *testing.T) {
+		test.Equals(t, http.StatusBadRequest, serve(&jwtutil.AuthInfo{UserId: 7}, "/users/me"))
+	})
+	t.Run("owner-zero", func(t *testing.T) {
+		test.Equals(t, http.StatusForbidden, serve(&jwtutil.AuthInfo{}, "/users/0"))
+		test.Equals(t, http.StatusOK, serve(&jwtutil.AuthInfo{Role: "admin"}, "/users/0"))
+	})
+}
@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// PanicError is the internal error of the api.ErrorUnknown that Recover renders for a panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// PanicReporter sends recovered panics to an error tracker such as Sentry.
+type PanicReporter interface {
+	ReportPanic(c echo.Context, err *PanicError)
+}
+
+type PanicReporterFunc func(c echo.Context, err *PanicError)
+
+func (f PanicReporterFunc) ReportPanic(c echo.Context, err *PanicError) {
+	f(c, err)
+}
+
+type RecoverConfig struct {
+	Skipper middleware.Skipper
+	// StackSize is the maximum size of the stack trace. Default: 4KB
+	StackSize int
+	// StackAll includes the stacks of all goroutines.
+	StackAll bool
+	Reporter PanicReporter
+}
+
+func Recover() echo.MiddlewareFunc {
+	return RecoverWithConfig(RecoverConfig{})
+}
+
+// RecoverWithConfig renders panics as api.ErrorUnknown. Register it after AccessLogger,
+// which then records the panic in AccessLog.Error and its stack in AccessLog.Stack.
+func RecoverWithConfig(config RecoverConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.StackSize <= 0 {
+		config.StackSize = 4 * 1024
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+
+				stack := make([]byte, config.StackSize)
+				stack = stack[:runtime.Stack(stack, config.StackAll)]
+				panicError := &PanicError{Value: r, Stack: stack}
+
+				Logger(c).WithError(panicError).WithField("stack", string(stack)).Error("Recovered from panic")
+				if config.Reporter != nil {
+					reportPanic(config.Reporter, c, panicError)
+				}
+				err = api.RenderFail(c, api.ErrorUnknown.New(panicError))
+			}()
+			return next(c)
+		}
+	}
+}
+
+func reportPanic(reporter PanicReporter, c echo.Context, err *PanicError) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithField("panic", r).Error("Fail to report panic")
+		}
+	}()
+	reporter.ReportPanic(c, err)
+}
+
+func panicStack(err error) string {
+	var panicError *PanicError
+	if errors.As(err, &panicError) {
+		return string(panicError.Stack)
+	}
+	return ""
+}
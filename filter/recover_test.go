@@ -0,0 +1,47 @@
+package filter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestRecover(t *testing.T) {
+	var reported *PanicError
+	register := func(e *echo.Echo) {
+		e.Use(RecoverWithConfig(RecoverConfig{
+			Reporter: PanicReporterFunc(func(c echo.Context, err *PanicError) {
+				test.Equals(t, "/orders/1", c.Request().URL.Path)
+				reported = err
+			}),
+		}))
+		e.GET("/orders/:id", func(c echo.Context) error {
+			panic("boom")
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	accessLog, rec := serveAccessLog(t, AccessLoggerConfig{}, register, req)
+
+	test.Equals(t, http.StatusInternalServerError, rec.Code)
+	var result struct {
+		Success bool
+		Error   struct {
+			Code    int
+			Details string
+		}
+	}
+	test.Ok(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	test.Equals(t, 10001, result.Error.Code)
+	test.Equals(t, "panic: boom", result.Error.Details)
+
+	test.Assert(t, reported != nil, "expected the panic to be reported")
+	test.Equals(t, "boom", reported.Value)
+	test.Equals(t, "[10001]Unknown error(panic: boom)", accessLog.Error)
+	test.Assert(t, strings.Contains(accessLog.Stack, "recover_test.go"), "expected the stack in the accesslog")
+}
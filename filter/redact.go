@@ -0,0 +1,346 @@
+package filter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jaehue/echo-kit/wildcard"
+)
+
+type RedactMode int
+
+const (
+	// RedactFull replaces the value with "*".
+	RedactFull RedactMode = iota
+	// RedactPartial masks all but the last Keep characters, e.g. "************1234".
+	RedactPartial
+	// RedactHash replaces the value with an HMAC keyed by RedactConfig.HashKey,
+	// so equal values can still be correlated. NewRedactor requires the HashKey.
+	RedactHash
+)
+
+// RedactRule selects the values to mask, either by Key or by Path.
+type RedactRule struct {
+	// Key is a wildcard pattern matched case-insensitively against body keys, parameter names and header names,
+	// e.g. "password" or "*secret*".
+	Key string
+	// Path is a JSONPath into the request body such as "$.user.phone" or "$.cards[*].number".
+	Path string
+	Mode RedactMode
+	Keep int // used by RedactPartial, default: 4
+}
+
+var DefaultRedactRules = []RedactRule{
+	{Key: "password"},
+	{Key: "passwd"},
+	{Key: "*secret*"},
+	{Key: "*token*"},
+	{Key: "authorization"},
+	{Key: "cookie"},
+	{Key: "card*{number,no}", Mode: RedactPartial},
+	{Key: "cvc"},
+	{Key: "cvv"},
+	{Key: "*phone*", Mode: RedactPartial},
+	{Key: "mobile", Mode: RedactPartial},
+}
+
+type RedactConfig struct {
+	Rules []RedactRule
+	// HashKey keys the HMAC used by RedactHash. Keep it secret: short values such as phone numbers
+	// can be recovered from their hash by anyone who knows the key.
+	HashKey string
+}
+
+type Redactor struct {
+	keys     *wildcard.Set
+	keyRules []RedactRule
+	paths    []redactPath
+	hashKey  []byte
+}
+
+type redactPath struct {
+	rule     RedactRule
+	segments []string // field names, "*" for any field or element, or "[n]" for an element
+}
+
+func NewRedactor(config RedactConfig) (*Redactor, error) {
+	r := &Redactor{hashKey: []byte(config.HashKey)}
+
+	var keys []string
+	for _, rule := range config.Rules {
+		if rule.Keep <= 0 {
+			rule.Keep = 4
+		}
+		if rule.Mode == RedactHash && config.HashKey == "" {
+			return nil, fmt.Errorf("Redact rule %q requires a HashKey", rule.Key+rule.Path)
+		}
+		switch {
+		case rule.Key != "" && rule.Path != "":
+			return nil, fmt.Errorf("Redact rule must have either a key or a path")
+		case rule.Key != "":
+			keys = append(keys, rule.Key)
+			r.keyRules = append(r.keyRules, rule)
+		case rule.Path != "":
+			segments, err := parseRedactPath(rule.Path)
+			if err != nil {
+				return nil, err
+			}
+			r.paths = append(r.paths, redactPath{rule: rule, segments: segments})
+		default:
+			return nil, fmt.Errorf("Redact rule must have a key or a path")
+		}
+	}
+
+	set, err := wildcard.CompileSet(keys, wildcard.CaseInsensitive())
+	if err != nil {
+		return nil, err
+	}
+	r.keys = set
+	return r, nil
+}
+
+func MustNewRedactor(config RedactConfig) *Redactor {
+	r, err := NewRedactor(config)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+var defaultRedactor = MustNewRedactor(RedactConfig{Rules: DefaultRedactRules})
+
+// Redact masks the values of a decoded JSON document in place and returns it.
+func (r *Redactor) Redact(v interface{}) interface{} {
+	if r == nil {
+		return v
+	}
+	v = r.redactKeys(v)
+	for _, path := range r.paths {
+		v = r.redactPath(v, path.segments, path.rule)
+	}
+	return v
+}
+
+// RedactValue masks value when name matches a key rule.
+func (r *Redactor) RedactValue(name string, value interface{}) interface{} {
+	if r == nil {
+		return value
+	}
+	if i := r.keys.MatchIndex(name); i >= 0 {
+		return r.mask(value, r.keyRules[i])
+	}
+	return r.redactKeys(value)
+}
+
+func (r *Redactor) RedactMap(m map[string]interface{}) {
+	for k, v := range m {
+		m[k] = r.RedactValue(k, v)
+	}
+}
+
+func (r *Redactor) RedactStringMap(m map[string]string) {
+	for k, v := range m {
+		m[k] = fmt.Sprint(r.RedactValue(k, v))
+	}
+}
+
+// RedactURL masks the query values of rawURL whose names match a key rule, keeping the other parameters as they are.
+// The query of a URL that can not be parsed is dropped.
+func (r *Redactor) RedactURL(rawURL string) string {
+	if r == nil {
+		return rawURL
+	}
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			return base
+		}
+		j := r.keys.MatchIndex(name)
+		if j < 0 {
+			continue
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return base
+		}
+		masked := url.QueryEscape(fmt.Sprint(r.mask(value, r.keyRules[j])))
+		pairs[i] = key + "=" + strings.ReplaceAll(masked, "%2A", "*")
+	}
+
+	redacted := base + "?" + strings.Join(pairs, "&")
+	if hasFragment {
+		redacted += "#" + fragment
+	}
+	return redacted
+}
+
+var (
+	// redactTextJSON finds "key": value pairs, including a string value cut by truncation
+	redactTextJSON = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[^\s,{}\[\]"]+)`)
+	// redactTextPair finds key=value pairs of forms, queries and logfmt lines
+	redactTextPair = regexp.MustCompile(`([\w.\-]+)=([^&\s]*)`)
+)
+
+// RedactText masks the values of the key/value pairs found in a body that can not be decoded,
+// such as a truncated JSON document or a text body.
+func (r *Redactor) RedactText(s string) string {
+	if r == nil {
+		return s
+	}
+	s = redactTextJSON.ReplaceAllStringFunc(s, func(m string) string {
+		sub := redactTextJSON.FindStringSubmatch(m)
+		i := r.keys.MatchIndex(sub[1])
+		if i < 0 {
+			return m
+		}
+		value, quoted := sub[3], strings.HasPrefix(sub[3], `"`)
+		if quoted {
+			value = strings.TrimSuffix(value[1:], `"`)
+		}
+		masked := fmt.Sprint(r.mask(value, r.keyRules[i]))
+		if quoted {
+			masked = `"` + masked + `"`
+		}
+		return `"` + sub[1] + `"` + sub[2] + masked
+	})
+	return redactTextPair.ReplaceAllStringFunc(s, func(m string) string {
+		sub := redactTextPair.FindStringSubmatch(m)
+		i := r.keys.MatchIndex(sub[1])
+		if i < 0 || sub[2] == "" {
+			return m
+		}
+		return sub[1] + "=" + fmt.Sprint(r.mask(sub[2], r.keyRules[i]))
+	})
+}
+
+func (r *Redactor) redactKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		r.RedactMap(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactKeys(v[i])
+		}
+	}
+	return v
+}
+
+func (r *Redactor) redactPath(v interface{}, segments []string, rule RedactRule) interface{} {
+	if len(segments) == 0 {
+		return r.mask(v, rule)
+	}
+	segment, rest := segments[0], segments[1:]
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if segment == "*" {
+			for k := range v {
+				v[k] = r.redactPath(v[k], rest, rule)
+			}
+		} else if child, ok := v[segment]; ok {
+			v[segment] = r.redactPath(child, rest, rule)
+		}
+	case []interface{}:
+		if segment == "*" {
+			for i := range v {
+				v[i] = r.redactPath(v[i], rest, rule)
+			}
+		} else if strings.HasPrefix(segment, "[") {
+			if i, err := strconv.Atoi(segment[1 : len(segment)-1]); err == nil && i >= 0 && i < len(v) {
+				v[i] = r.redactPath(v[i], rest, rule)
+			}
+		}
+	}
+	return v
+}
+
+func (r *Redactor) mask(v interface{}, rule RedactRule) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return "*"
+	}
+
+	s := fmt.Sprint(v)
+	if f, ok := v.(float64); ok {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	switch rule.Mode {
+	case RedactPartial:
+		runes := []rune(s)
+		if len(runes) <= rule.Keep {
+			return "*"
+		}
+		return strings.Repeat("*", len(runes)-rule.Keep) + string(runes[len(runes)-rule.Keep:])
+	case RedactHash:
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(s))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	default:
+		return "*"
+	}
+}
+
+// parseRedactPath parses the JSONPath subset "$.a.b", "$.a[*].b", "$.a[0]" and "$['a']".
+func parseRedactPath(path string) ([]string, error) {
+	invalid := func() ([]string, error) {
+		return nil, fmt.Errorf("Invalid redact path %q", path)
+	}
+	if !strings.HasPrefix(path, "$") {
+		return invalid()
+	}
+
+	var segments []string
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return invalid()
+			}
+			segments = append(segments, name)
+			rest = rest[end+1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return invalid()
+			}
+			inner := rest[1:end]
+			switch {
+			case inner == "*":
+				segments = append(segments, "*")
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, inner[1:len(inner)-1])
+			default:
+				if _, err := strconv.Atoi(inner); err != nil {
+					return invalid()
+				}
+				segments = append(segments, "["+inner+"]")
+			}
+			rest = rest[end+1:]
+		default:
+			return invalid()
+		}
+	}
+	return segments, nil
+}
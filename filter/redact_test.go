@@ -0,0 +1,64 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactor(RedactConfig{
+		Rules: append(DefaultRedactRules,
+			RedactRule{Path: "$.items[*].serial", Mode: RedactHash},
+			RedactRule{Path: "$.address['zip']"},
+		),
+		HashKey: "k",
+	})
+	test.Ok(t, err)
+
+	var body interface{}
+	test.Ok(t, json.Unmarshal([]byte(`{
+		"password": "a\"b",
+		"user": {"name": "kim", "mobilePhone": "01012345678", "refresh_token": "abc"},
+		"cardNumber": 4111111111111111,
+		"items": [{"serial": "S-1"}, {"serial": "S-1"}],
+		"address": {"zip": "06236", "city": "Seoul"}
+	}`), &body))
+
+	m := r.Redact(body).(map[string]interface{})
+	test.Equals(t, "*", m["password"])
+	test.Equals(t, "kim", m["user"].(map[string]interface{})["name"])
+	test.Equals(t, "*******5678", m["user"].(map[string]interface{})["mobilePhone"])
+	test.Equals(t, "*", m["user"].(map[string]interface{})["refresh_token"])
+	test.Equals(t, "************1111", m["cardNumber"])
+	items := m["items"].([]interface{})
+	test.Equals(t, items[0].(map[string]interface{})["serial"], items[1].(map[string]interface{})["serial"])
+	test.Assert(t, items[0].(map[string]interface{})["serial"] != "S-1", "serial must be hashed")
+	test.Equals(t, "*", m["address"].(map[string]interface{})["zip"])
+	test.Equals(t, "Seoul", m["address"].(map[string]interface{})["city"])
+
+	_, err = NewRedactor(RedactConfig{Rules: []RedactRule{{Key: "phone", Mode: RedactHash}}})
+	test.Assert(t, err != nil, "RedactHash without a HashKey must fail")
+	_, err = NewRedactor(RedactConfig{Rules: []RedactRule{{Path: "items"}}})
+	test.Assert(t, err != nil, "expected invalid path error")
+
+	for raw, expected := range map[string]string{
+		"/login?user=kim&password=p%40ss&access_token=t#top":     "/login?user=kim&password=*&access_token=*#top",
+		"https://shop.example.com/cards?cardNo=4111111111111111": "https://shop.example.com/cards?cardNo=************1111",
+		"/orders?q=a+b":    "/orders?q=a+b",
+		"/orders":          "/orders",
+		"/reset?token=%zz": "/reset",
+	} {
+		test.Equals(t, expected, r.RedactURL(raw))
+	}
+
+	for text, expected := range map[string]string{
+		`{"name":"kim","password":"p\"w","cardNo":4111111111111111,"items":[1]}`: `{"name":"kim","password":"*","cardNo":************1111,"items":[1]}`,
+		`{"user":{"refresh_token": "abcdef`:                                      `{"user":{"refresh_token": "*"`,
+		`name=kim&passwd=1234&mobile=01012345678`:                                `name=kim&passwd=*&mobile=*******5678`,
+		`level=info secret=s3cr3t msg=hello`:                                     `level=info secret=* msg=hello`,
+	} {
+		test.Equals(t, expected, r.RedactText(text))
+	}
+}
@@ -0,0 +1,186 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type bodyKind int
+
+const (
+	bodyNone bodyKind = iota
+	bodyJSON
+	bodyForm
+	bodyMultipart
+	bodyText
+	bodyBinary
+)
+
+func requestBodyKind(req *http.Request) bodyKind {
+	if req.Method != http.MethodPost &&
+		req.Method != http.MethodPut &&
+		req.Method != http.MethodPatch &&
+		req.Method != http.MethodDelete {
+		return bodyNone
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return bodyNone
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	switch {
+	case mediaType == "":
+		if req.ContentLength == 0 {
+			return bodyNone
+		}
+		return bodyBinary
+	case mediaType == echo.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json"):
+		return bodyJSON
+	case mediaType == echo.MIMEApplicationForm:
+		return bodyForm
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return bodyMultipart
+	case strings.HasPrefix(mediaType, "text/") || mediaType == echo.MIMEApplicationXML:
+		return bodyText
+	default:
+		return bodyBinary
+	}
+}
+
+// bodyTee copies up to max bytes of the request body while the handler reads it,
+// so that the body is never buffered twice.
+type bodyTee struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+	eof       bool
+}
+
+func (b *bodyTee) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *bodyTee) capture(p []byte) {
+	if b.truncated {
+		return
+	}
+	if room := b.max - int64(b.buf.Len()); int64(len(p)) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+}
+
+// limit lowers max, truncating the captured body.
+func (b *bodyTee) limit(max int64) {
+	b.max = max
+	if int64(b.buf.Len()) > max {
+		b.buf.Truncate(int(max))
+		b.truncated = true
+	}
+}
+
+// drain captures the part of the body the handler did not read.
+func (b *bodyTee) drain() {
+	if b.eof || b.truncated {
+		return
+	}
+	if _, err := io.CopyN(io.Discard, b, b.max-int64(b.buf.Len())+1); err == nil {
+		b.truncated = true
+	}
+}
+
+// requestBodyLog returns the AccessLog.Body of a request once the handler has returned.
+func requestBodyLog(req *http.Request, kind bodyKind, tee *bodyTee, redactor *Redactor) interface{} {
+	switch kind {
+	case bodyJSON:
+		tee.drain()
+		return decodeBodyLog(tee.buf.Bytes(), tee.truncated, redactor)
+	case bodyForm:
+		tee.drain()
+		body := tee.buf.String()
+		if tee.truncated {
+			// the last field may be cut
+			if i := strings.LastIndex(body, "&"); i >= 0 {
+				body = body[:i]
+			}
+		}
+		values, _ := url.ParseQuery(body)
+		form := formLog(values)
+		redactor.RedactMap(form)
+		return form
+	case bodyMultipart:
+		return multipartLog(req, redactor)
+	case bodyText:
+		tee.drain()
+		s := redactor.RedactText(tee.buf.String())
+		if tee.truncated {
+			s += "...(truncated)"
+		}
+		return s
+	case bodyBinary:
+		return fmt.Sprintf("(omitted %s, %d bytes)", req.Header.Get(echo.HeaderContentType), req.ContentLength)
+	}
+	return nil
+}
+
+func formLog(values url.Values) map[string]interface{} {
+	form := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if len(v) == 1 {
+			form[k] = v[0]
+		} else {
+			vv := make([]interface{}, len(v))
+			for i := range v {
+				vv[i] = v[i]
+			}
+			form[k] = vv
+		}
+	}
+	return form
+}
+
+// multipartLog summarizes the multipart form parsed by the handler without keeping file contents.
+func multipartLog(req *http.Request, redactor *Redactor) interface{} {
+	if req.MultipartForm == nil {
+		return fmt.Sprintf("(omitted %s, %d bytes)", req.Header.Get(echo.HeaderContentType), req.ContentLength)
+	}
+
+	fields := formLog(req.MultipartForm.Value)
+	redactor.RedactMap(fields)
+
+	var files []interface{}
+	for field, headers := range req.MultipartForm.File {
+		for _, h := range headers {
+			files = append(files, map[string]interface{}{
+				"field":        field,
+				"filename":     h.Filename,
+				"size":         h.Size,
+				"content_type": h.Header.Get(echo.HeaderContentType),
+			})
+		}
+	}
+
+	summary := map[string]interface{}{}
+	if len(fields) > 0 {
+		summary["fields"] = fields
+	}
+	if len(files) > 0 {
+		summary["files"] = files
+	}
+	return summary
+}
@@ -0,0 +1,138 @@
+package filter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/random"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestIDContextKey struct{}
+type actionIDContextKey struct{}
+
+type RequestIDConfig struct {
+	Skipper middleware.Skipper
+	// Generator creates a request id when the request has none. Default: 32 random characters
+	Generator func() string
+}
+
+func RequestID() echo.MiddlewareFunc {
+	return RequestIDWithConfig(RequestIDConfig{})
+}
+
+// RequestIDWithConfig accepts or generates X-Request-ID, and accepts X-Action-ID, the id of the user action
+// the request belongs to. Both are echoed in the response and stored in the request context,
+// where RequestIDTransport picks them up for outgoing requests.
+func RequestIDWithConfig(config RequestIDConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Generator == nil {
+		config.Generator = func() string { return random.String(32) }
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			requestID := req.Header.Get(HeaderXRequestID)
+			if !validID(requestID) {
+				requestID = config.Generator()
+				req.Header.Set(HeaderXRequestID, requestID)
+			}
+			actionID := req.Header.Get(HeaderXActionID)
+			if !validID(actionID) {
+				actionID = ""
+				req.Header.Del(HeaderXActionID)
+			}
+
+			c.Response().Header().Set(HeaderXRequestID, requestID)
+			if actionID != "" {
+				c.Response().Header().Set(HeaderXActionID, actionID)
+			}
+
+			c.SetRequest(req.WithContext(WithRequestID(req.Context(), requestID, actionID)))
+			return next(c)
+		}
+	}
+}
+
+// validID accepts up to 128 printable ASCII characters, so that an id can not forge log lines.
+func validID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func WithRequestID(ctx context.Context, requestID, actionID string) context.Context {
+	if requestID != "" {
+		ctx = context.WithValue(ctx, requestIDContextKey{}, requestID)
+	}
+	if actionID != "" {
+		ctx = context.WithValue(ctx, actionIDContextKey{}, actionID)
+	}
+	return ctx
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+func ActionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(actionIDContextKey{}).(string)
+	return id
+}
+
+// RequestIDTransport adds the request and action ids and the trace context of the request context
+// to outgoing requests:
+//
+//	client := &http.Client{Transport: &filter.RequestIDTransport{}}
+//	req, _ := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, url, nil)
+type RequestIDTransport struct {
+	Base       http.RoundTripper             // default: http.DefaultTransport
+	Propagator propagation.TextMapPropagator // default: W3C traceparent and tracestate
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	requestID, actionID := RequestIDFromContext(req.Context()), ActionIDFromContext(req.Context())
+	traced := trace.SpanContextFromContext(req.Context()).IsValid()
+	if requestID == "" && actionID == "" && !traced {
+		return base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	if requestID != "" && req.Header.Get(HeaderXRequestID) == "" {
+		req.Header.Set(HeaderXRequestID, requestID)
+	}
+	if actionID != "" && req.Header.Get(HeaderXActionID) == "" {
+		req.Header.Set(HeaderXActionID, actionID)
+	}
+	if traced {
+		propagator := t.Propagator
+		if propagator == nil {
+			propagator = propagation.TraceContext{}
+		}
+		propagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestRequestID(t *testing.T) {
+	var outgoing http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outgoing = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	e := echo.New()
+	e.Use(RequestID())
+	e.GET("/", func(c echo.Context) error {
+		req, _ := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, upstream.URL, nil)
+		res, err := (&http.Client{Transport: &RequestIDTransport{}}).Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return c.String(http.StatusOK, RequestIDFromContext(c.Request().Context()))
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderXRequestID, "req-1")
+		req.Header.Set(HeaderXActionID, "action-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		test.Equals(t, "req-1", rec.Body.String())
+		test.Equals(t, "req-1", rec.Header().Get(HeaderXRequestID))
+		test.Equals(t, "action-1", rec.Header().Get(HeaderXActionID))
+		test.Equals(t, "req-1", outgoing.Get(HeaderXRequestID))
+		test.Equals(t, "action-1", outgoing.Get(HeaderXActionID))
+	})
+
+	t.Run("Generate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderXRequestID, "bad id\n")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(HeaderXRequestID)
+		test.Equals(t, 32, len(id))
+		test.Equals(t, id, rec.Body.String())
+		test.Equals(t, id, outgoing.Get(HeaderXRequestID))
+		test.Equals(t, "", outgoing.Get(HeaderXActionID))
+	})
+
+	t.Run("AccessLog", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderXActionID, "action-2")
+		accessLog, rec := serveAccessLog(t, AccessLoggerConfig{}, func(e *echo.Echo) {
+			e.Use(RequestID())
+			e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		}, req)
+
+		test.Equals(t, rec.Header().Get(HeaderXRequestID), accessLog.RequestID)
+		test.Equals(t, "action-2", accessLog.ActionID)
+	})
+}
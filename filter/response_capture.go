@@ -0,0 +1,163 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ResponseCaptureConfig struct {
+	// Routes limits the capture to the requests matched by one of the rules,
+	// in the same syntax as JWTConfig.Ignore. Default: all requests
+	Routes []string
+	// Statuses limits the capture to status codes such as "201", "4xx" or "500-503". Default: all
+	Statuses []string
+	// ContentTypes limits the capture to these media type prefixes. Default: application/json
+	ContentTypes []string
+	// MaxSize truncates the captured body. Default: 64KB
+	MaxSize int
+}
+
+type responseCapture struct {
+	routes       *IgnoreRules
+	statuses     [][2]int
+	contentTypes []string
+	maxSize      int
+}
+
+func newResponseCapture(config *ResponseCaptureConfig) (*responseCapture, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	capture := &responseCapture{
+		contentTypes: config.ContentTypes,
+		maxSize:      config.MaxSize,
+	}
+	if len(capture.contentTypes) == 0 {
+		capture.contentTypes = []string{echo.MIMEApplicationJSON}
+	}
+	if capture.maxSize <= 0 {
+		capture.maxSize = 64 * 1024
+	}
+	if len(config.Routes) > 0 {
+		routes, err := CompileIgnoreRules(config.Routes)
+		if err != nil {
+			return nil, err
+		}
+		capture.routes = routes
+	}
+	for _, s := range config.Statuses {
+		r, err := parseStatusRange(s)
+		if err != nil {
+			return nil, err
+		}
+		capture.statuses = append(capture.statuses, r)
+	}
+	return capture, nil
+}
+
+func parseStatusRange(s string) ([2]int, error) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+		lo := int(s[0]-'0') * 100
+		return [2]int{lo, lo + 99}, nil
+	}
+	if i := strings.Index(s, "-"); i > 0 {
+		lo, err1 := strconv.Atoi(s[:i])
+		hi, err2 := strconv.Atoi(s[i+1:])
+		if err1 == nil && err2 == nil && lo <= hi {
+			return [2]int{lo, hi}, nil
+		}
+	} else if status, err := strconv.Atoi(s); err == nil {
+		return [2]int{status, status}, nil
+	}
+	return [2]int{}, fmt.Errorf("Invalid status range %q", s)
+}
+
+func (rc *responseCapture) matchRequest(req *http.Request) bool {
+	return rc.routes == nil || rc.routes.Match(req)
+}
+
+func (rc *responseCapture) matchResponse(status int, contentType string) bool {
+	if len(rc.statuses) > 0 {
+		matched := false
+		for _, r := range rc.statuses {
+			if r[0] <= status && status <= r[1] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range rc.contentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureResponseWriter copies up to maxSize bytes of the response while it is written,
+// and keeps http.Flusher and http.Hijacker working for streaming responses.
+type captureResponseWriter struct {
+	http.ResponseWriter
+	capture *responseCapture
+
+	decided   bool
+	capturing bool
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (w *captureResponseWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.decided = true
+		w.capturing = w.capture.matchResponse(code, w.Header().Get(echo.HeaderContentType))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *captureResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.capturing && !w.truncated {
+		if room := w.capture.maxSize - w.buf.Len(); len(b) > room {
+			w.buf.Write(b[:room])
+			w.truncated = true
+		} else {
+			w.buf.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *captureResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", w.ResponseWriter)
+	}
+	// the connection is no longer an HTTP response
+	w.capturing = false
+	return hijacker.Hijack()
+}
+
+func (w *captureResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,325 @@
+package filter
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const rotatedFileTimeFormat = "2006-01-02T15-04-05.000"
+
+type RotateOptions struct {
+	MaxSize    int64         // rotate when the file would exceed MaxSize bytes, 0 disables
+	Daily      bool          // rotate when the local date changes
+	MaxBackups int           // number of rotated files to keep, 0 keeps all
+	MaxAge     time.Duration // remove rotated files older than MaxAge, 0 keeps all
+	Compress   bool          // gzip rotated files
+	// ReopenOnSIGHUP reopens the file on SIGHUP, for an external logrotate that moves the file.
+	ReopenOnSIGHUP bool
+}
+
+// rotatingFile is an io.WriteCloser that rotates filename by size and by day.
+// Rotated files are named "<filename>.<time>" with ".gz" appended when compressed.
+type rotatingFile struct {
+	filename string
+	options  RotateOptions
+
+	mutex    sync.Mutex
+	closed   bool
+	file     *os.File // nil when a rotation failed to open any file
+	size     int64
+	openedAt time.Time
+
+	mill    chan struct{}
+	millWG  sync.WaitGroup
+	signals chan os.Signal
+}
+
+func openRotatingFile(filename string, options RotateOptions) (*rotatingFile, error) {
+	f := &rotatingFile{
+		filename: filename,
+		options:  options,
+		mill:     make(chan struct{}, 1),
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	f.millWG.Add(1)
+	go f.runMill()
+
+	if options.ReopenOnSIGHUP {
+		f.signals = make(chan os.Signal, 1)
+		signal.Notify(f.signals, syscall.SIGHUP)
+		go func() {
+			for range f.signals {
+				if err := f.Reopen(); err != nil {
+					logrus.WithError(err).Error("Fail to reopen accesslog file")
+				}
+			}
+		}()
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now()
+	daily := f.options.Daily && !sameDay(now, f.openedAt)
+	if daily || (f.options.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.options.MaxSize) {
+		// a daily file is named by the day it holds
+		stamp := now
+		if daily {
+			stamp = f.openedAt
+		}
+		if err := f.rotate(stamp); err != nil {
+			if f.file == nil {
+				return 0, err
+			}
+			logrus.WithError(err).Error("Fail to rotate accesslog file")
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen reopens the file, e.g. after it was moved by logrotate.
+// The current file is kept when the new one can not be opened.
+func (f *rotatingFile) Reopen() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	old := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	if old == nil {
+		return nil
+	}
+	return old.Close()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mutex.Lock()
+	if f.signals != nil {
+		signal.Stop(f.signals)
+		close(f.signals)
+		f.signals = nil
+	}
+	var err error
+	if !f.closed {
+		f.closed = true
+		if f.file != nil {
+			if err = f.file.Sync(); err == nil {
+				err = f.file.Close()
+			} else {
+				f.file.Close()
+			}
+			f.file = nil
+		}
+		close(f.mill)
+	}
+	f.mutex.Unlock()
+
+	f.millWG.Wait()
+	return err
+}
+
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.size > 0 {
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// rotate renames the file after stamp and opens a new one.
+// When that fails, it writes to the original file again; f.file is nil only when even that fails.
+func (f *rotatingFile) rotate(stamp time.Time) error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+
+	rotated := f.filename + "." + stamp.Format(rotatedFileTimeFormat)
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%s.%d", f.filename, stamp.Format(rotatedFileTimeFormat), i)
+	}
+	if err := os.Rename(f.filename, rotated); err != nil {
+		if reopenErr := f.open(); reopenErr != nil {
+			return reopenErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		if os.Rename(rotated, f.filename) == nil {
+			if reopenErr := f.open(); reopenErr != nil {
+				return reopenErr
+			}
+		}
+		return err
+	}
+
+	select {
+	case f.mill <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// runMill compresses and removes rotated files in the background.
+func (f *rotatingFile) runMill() {
+	defer f.millWG.Done()
+	for range f.mill {
+		if err := f.compressAndClean(); err != nil {
+			logrus.WithError(err).Error("Fail to clean rotated accesslog files")
+		}
+	}
+}
+
+func (f *rotatingFile) compressAndClean() error {
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	var remove []string
+	if f.options.MaxBackups > 0 && len(backups) > f.options.MaxBackups {
+		remove = append(remove, backups[f.options.MaxBackups:]...)
+		backups = backups[:f.options.MaxBackups]
+	}
+	if f.options.MaxAge > 0 {
+		cutoff := time.Now().Add(-f.options.MaxAge)
+		var kept []string
+		for _, name := range backups {
+			if info, err := os.Stat(name); err == nil && info.ModTime().Before(cutoff) {
+				remove = append(remove, name)
+			} else {
+				kept = append(kept, name)
+			}
+		}
+		backups = kept
+	}
+	for _, name := range remove {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if f.options.Compress {
+		for _, name := range backups {
+			if strings.HasSuffix(name, ".gz") {
+				continue
+			}
+			if err := gzipFile(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backups returns the rotated files, newest first.
+func (f *rotatingFile) backups() ([]string, error) {
+	names, err := filepath.Glob(f.filename + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := f.filename + "."
+	var backups []string
+	for _, name := range names {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		if len(stamp) < len(rotatedFileTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(rotatedFileTimeFormat, stamp[:len(rotatedFileTimeFormat)]); err != nil {
+			continue
+		}
+		backups = append(backups, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,55 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestRotatingFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "access.log")
+	f, err := openRotatingFile(filename, RotateOptions{MaxSize: 100, MaxBackups: 2, Compress: true})
+	test.Ok(t, err)
+
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 6; i++ {
+		_, err := f.Write(line)
+		test.Ok(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+	test.Ok(t, f.Close())
+
+	info, err := os.Stat(filename)
+	test.Ok(t, err)
+	test.Equals(t, int64(60), info.Size())
+
+	backups, err := filepath.Glob(filename + ".*")
+	test.Ok(t, err)
+	test.Equals(t, 2, len(backups))
+	for _, name := range backups {
+		test.Assert(t, strings.HasSuffix(name, ".gz"), "%s is not compressed", name)
+	}
+
+	_, err = NewFileLogWriter(filepath.Join(filename, "not-a-dir", "access.log"), RotateOptions{})
+	test.Assert(t, err != nil, "expected error")
+
+	t.Run("daily", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "access.log")
+		f, err := openRotatingFile(filename, RotateOptions{Daily: true})
+		test.Ok(t, err)
+		defer f.Close()
+
+		yesterday := time.Now().AddDate(0, 0, -1)
+		f.openedAt = yesterday
+		_, err = f.Write([]byte("today\n"))
+		test.Ok(t, err)
+
+		backups, err := filepath.Glob(filename + "." + yesterday.Format("2006-01-02") + "T*")
+		test.Ok(t, err)
+		test.Equals(t, 1, len(backups))
+	})
+}
@@ -0,0 +1,15 @@
+package filter
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// ignoreSkipper skips requests matching one of the ignore rules.
+// It panics when a rule can not be compiled, so that mistakes surface when the middleware is built.
+func ignoreSkipper(ignore []string) middleware.Skipper {
+	rules := MustCompileIgnoreRules(ignore)
+	return func(c echo.Context) bool {
+		return rules.Match(c.Request())
+	}
+}
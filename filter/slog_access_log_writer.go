@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+type SlogAccessLogConfig struct {
+	Handler slog.Handler // default: slog.Default().Handler()
+	Message string       // default: "accesslog"
+	// SlowThreshold is the latency from which the default Level logs at Warn. Default: 1 second
+	SlowThreshold time.Duration
+	// Level maps an entry to its level. Default: Error for errors and 5xx, Warn for slow requests, otherwise Info.
+	// An entry flagged by AccessLoggerConfig.SlowRequest is slow whatever SlowThreshold is.
+	Level func(accessLog *AccessLog) slog.Level
+}
+
+type slogAccessLogWriter struct {
+	config SlogAccessLogConfig
+}
+
+func SlogAccessLogWriter(handler slog.Handler) AccessLogWriter {
+	return SlogAccessLogWriterWithConfig(SlogAccessLogConfig{Handler: handler})
+}
+
+// SlogAccessLogWriterWithConfig writes entries as typed attributes, with the request and response fields
+// grouped under "request" and "response".
+func SlogAccessLogWriterWithConfig(config SlogAccessLogConfig) AccessLogWriter {
+	if config.Handler == nil {
+		config.Handler = slog.Default().Handler()
+	}
+	if config.Message == "" {
+		config.Message = "accesslog"
+	}
+	if config.SlowThreshold <= 0 {
+		config.SlowThreshold = time.Second
+	}
+	if config.Level == nil {
+		isError, isSlow := IsError(), SlowerThan(config.SlowThreshold)
+		config.Level = func(accessLog *AccessLog) slog.Level {
+			switch {
+			case isError(accessLog):
+				return slog.LevelError
+			case accessLog.Slow || isSlow(accessLog):
+				return slog.LevelWarn
+			default:
+				return slog.LevelInfo
+			}
+		}
+	}
+	return &slogAccessLogWriter{config: config}
+}
+
+func (w *slogAccessLogWriter) Write(accessLog *AccessLog) {
+	ctx := context.Background()
+	level := w.config.Level(accessLog)
+	if !w.config.Handler.Enabled(ctx, level) {
+		return
+	}
+
+	timestamp := accessLog.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	record := slog.NewRecord(timestamp, level, w.config.Message, 0)
+	record.AddAttrs(slogAccessLogAttrs(accessLog)...)
+	w.config.Handler.Handle(ctx, record)
+}
+
+func slogAccessLogAttrs(accessLog *AccessLog) []slog.Attr {
+	var attrs slogAttrs
+	attrs.string("request_id", accessLog.RequestID)
+	attrs.string("action_id", accessLog.ActionID)
+	attrs.string("trace_id", accessLog.TraceID)
+	attrs.string("span_id", accessLog.SpanID)
+	attrs.string("session_id", accessLog.SessionID)
+	if accessLog.UserId != 0 {
+		attrs = append(attrs, slog.Int64("user_id", accessLog.UserId))
+	}
+	attrs.string("controller", accessLog.Controller)
+	attrs.string("action", accessLog.Action)
+	attrs.string("remote_ip", accessLog.RemoteIP)
+	attrs.string("hostname", accessLog.Hostname)
+	attrs = append(attrs, slog.Duration("latency", time.Duration(accessLog.Latency*float64(time.Second))))
+	attrs.string("error", accessLog.Error)
+	attrs.string("stack", accessLog.Stack)
+	if accessLog.Slow {
+		attrs = append(attrs, slog.Bool("slow", true))
+	}
+	attrs.string("goroutine_dump", accessLog.GoroutineDump)
+
+	var request slogAttrs
+	request.string("method", accessLog.Method)
+	request.string("host", accessLog.Host)
+	request.string("proto", accessLog.Proto)
+	request.string("uri", accessLog.Uri)
+	request.string("path", accessLog.Path)
+	request.string("referer", accessLog.Referer)
+	request.string("user_agent", accessLog.UserAgent)
+	if accessLog.RequestLength != 0 {
+		request = append(request, slog.Int64("length", accessLog.RequestLength))
+	}
+	if len(accessLog.Params) > 0 {
+		request = append(request, slogMapGroup("params", accessLog.Params))
+	}
+	if len(accessLog.Headers) > 0 {
+		headers := make(map[string]interface{}, len(accessLog.Headers))
+		for k, v := range accessLog.Headers {
+			headers[k] = v
+		}
+		request = append(request, slogMapGroup("headers", headers))
+	}
+	if accessLog.Body != nil {
+		request = append(request, slog.Any("body", accessLog.Body))
+	}
+	attrs = append(attrs, slog.Attr{Key: "request", Value: slog.GroupValue(request...)})
+
+	response := slogAttrs{
+		slog.Int("status", accessLog.Status),
+		slog.Int64("bytes_sent", accessLog.BytesSent),
+	}
+	if accessLog.ResponseBody != nil {
+		response = append(response, slog.Any("body", accessLog.ResponseBody))
+	}
+	attrs = append(attrs, slog.Attr{Key: "response", Value: slog.GroupValue(response...)})
+
+	if len(accessLog.Extra) > 0 {
+		attrs = append(attrs, slogMapGroup("extra", accessLog.Extra))
+	}
+	return attrs
+}
+
+type slogAttrs []slog.Attr
+
+// string adds a string attribute, omitting empty values like the file writer.
+func (attrs *slogAttrs) string(key, value string) {
+	if value != "" {
+		*attrs = append(*attrs, slog.String(key, value))
+	}
+}
+
+// slogMapGroup sorts the keys so that text handlers write them in a stable order.
+func slogMapGroup(key string, m map[string]interface{}) slog.Attr {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(m))
+	for _, k := range keys {
+		attrs = append(attrs, slog.Any(k, m[k]))
+	}
+	return slog.Attr{Key: key, Value: slog.GroupValue(attrs...)}
+}
@@ -0,0 +1,112 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestSlogAccessLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	write := func(w AccessLogWriter, accessLog *AccessLog) map[string]interface{} {
+		buf.Reset()
+		w.Write(accessLog)
+		var m map[string]interface{}
+		test.Ok(t, json.Unmarshal(buf.Bytes(), &m))
+		return m
+	}
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	w := SlogAccessLogWriter(slog.NewJSONHandler(&buf, nil))
+
+	m := write(w, &AccessLog{
+		Timestamp: timestamp, RequestID: "req-1", UserId: 7, Method: "GET", Path: "/orders/1",
+		Params: map[string]interface{}{"id": "1"}, Status: 200, BytesSent: 12, Latency: 0.25,
+	})
+	test.Equals(t, "INFO", m["level"])
+	test.Equals(t, "2026-01-02T03:04:05Z", m["time"])
+	test.Equals(t, "req-1", m["request_id"])
+	test.Equals(t, float64(7), m["user_id"])
+	test.Equals(t, float64(250*time.Millisecond), m["latency"])
+	test.Equals(t, map[string]interface{}{"method": "GET", "path": "/orders/1", "params": map[string]interface{}{"id": "1"}}, m["request"])
+	test.Equals(t, map[string]interface{}{"status": float64(200), "bytes_sent": float64(12)}, m["response"])
+
+	test.Equals(t, "ERROR", write(w, &AccessLog{Status: 500})["level"])
+	test.Equals(t, "WARN", write(w, &AccessLog{Status: 200, Latency: 1.5})["level"])
+
+	w = SlogAccessLogWriterWithConfig(SlogAccessLogConfig{
+		Handler: slog.NewJSONHandler(&buf, nil),
+		Level: func(accessLog *AccessLog) slog.Level {
+			if accessLog.Status >= 400 {
+				return slog.LevelWarn
+			}
+			return slog.LevelInfo
+		},
+	})
+	test.Equals(t, "WARN", write(w, &AccessLog{Status: 404})["level"])
+}
+
+// TestSlogAccessLogWriterFields fails when an AccessLog field is added without being written.
+func TestSlogAccessLogWriterFields(t *testing.T) {
+	paths := map[string]string{
+		"Timestamp": "time", "UserId": "user_id",
+		"Host": "request.host", "Uri": "request.uri", "Method": "request.method", "Proto": "request.proto",
+		"Path": "request.path", "Referer": "request.referer", "UserAgent": "request.user_agent",
+		"RequestLength": "request.length", "Params": "request.params", "Headers": "request.headers", "Body": "request.body",
+		"Status": "response.status", "BytesSent": "response.bytes_sent", "ResponseBody": "response.body",
+	}
+
+	var accessLog AccessLog
+	v := reflect.ValueOf(&accessLog).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if _, ok := paths[field.Name]; !ok {
+			paths[field.Name] = name
+		}
+
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString("x")
+		case reflect.Int, reflect.Int64:
+			value.SetInt(1)
+		case reflect.Float64:
+			value.SetFloat(1)
+		case reflect.Bool:
+			value.SetBool(true)
+		case reflect.Interface:
+			value.Set(reflect.ValueOf("x"))
+		case reflect.Map:
+			m := reflect.MakeMap(value.Type())
+			m.SetMapIndex(reflect.ValueOf("k"), reflect.ValueOf("x").Convert(value.Type().Elem()))
+			value.Set(m)
+		case reflect.Struct:
+			value.Set(reflect.ValueOf(time.Now()))
+		default:
+			t.Fatalf("unexpected kind of %s: %s", field.Name, value.Kind())
+		}
+	}
+
+	var buf bytes.Buffer
+	SlogAccessLogWriter(slog.NewJSONHandler(&buf, nil)).Write(&accessLog)
+	var m map[string]interface{}
+	test.Ok(t, json.Unmarshal(buf.Bytes(), &m))
+
+	for name, path := range paths {
+		var found interface{} = m
+		for _, key := range strings.Split(path, ".") {
+			group, _ := found.(map[string]interface{})
+			found = group[key]
+		}
+		test.Assert(t, found != nil, "%s is not written as %s", name, path)
+	}
+}
@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type SlowRequestConfig struct {
+	// Threshold is the latency from which a request is slow. Default: 1 second
+	Threshold time.Duration
+	// Routes overrides Threshold for the matching requests. The first match wins.
+	Routes []SlowRoute
+	// Hooks are called in the background with every slow entry, after it is written.
+	Hooks []SlowRequestHook
+
+	// MaxBodySize is the request body recorded for the slow requests of a route with CaptureBody. Default: 1MB
+	MaxBodySize int64
+	// GoroutineDump records the goroutines of the process, taken when a request passes its threshold
+	// while still running, in AccessLog.GoroutineDump. The dump stops the world, so at most one is taken per DumpInterval.
+	GoroutineDump bool
+	MaxDumpSize   int           // default: 64KB
+	DumpInterval  time.Duration // default: 1 minute
+}
+
+type SlowRoute struct {
+	// Route is a rule in the syntax of JWTConfig.Ignore, e.g. "GET /reports/**"
+	Route     string
+	Threshold time.Duration
+	// CaptureBody records up to SlowRequestConfig.MaxBodySize of the request body of slow requests,
+	// instead of AccessLoggerConfig.MaxBodySize. Every request of the route keeps that much in memory until it ends.
+	CaptureBody bool
+}
+
+type SlowRequestHook func(accessLog *AccessLog)
+
+type slowRequest struct {
+	config SlowRequestConfig
+	routes []*IgnoreRules
+
+	lastDump int64 // unix nanoseconds
+}
+
+func newSlowRequest(config *SlowRequestConfig) (*slowRequest, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	s := &slowRequest{config: *config}
+	if s.config.Threshold <= 0 {
+		s.config.Threshold = time.Second
+	}
+	if s.config.MaxBodySize <= 0 {
+		s.config.MaxBodySize = 1024 * 1024
+	}
+	if s.config.MaxDumpSize <= 0 {
+		s.config.MaxDumpSize = 64 * 1024
+	}
+	if s.config.DumpInterval <= 0 {
+		s.config.DumpInterval = time.Minute
+	}
+	for _, route := range s.config.Routes {
+		rules, err := CompileIgnoreRules([]string{route.Route})
+		if err != nil {
+			return nil, err
+		}
+		s.routes = append(s.routes, rules)
+	}
+	return s, nil
+}
+
+// route returns the threshold of req and whether its body is captured.
+func (s *slowRequest) route(req *http.Request) (threshold time.Duration, captureBody bool) {
+	for i, rules := range s.routes {
+		if rules.Match(req) {
+			return s.config.Routes[i].Threshold, s.config.Routes[i].CaptureBody
+		}
+	}
+	return s.config.Threshold, false
+}
+
+// watch takes a goroutine dump when the request is still running after threshold,
+// unless another one was taken during DumpInterval.
+// The returned function stops watching and returns the dump, if any.
+func (s *slowRequest) watch(threshold time.Duration) func() string {
+	if !s.config.GoroutineDump {
+		return func() string { return "" }
+	}
+
+	var (
+		mutex sync.Mutex
+		dump  string
+	)
+	timer := time.AfterFunc(threshold, func() {
+		now := time.Now().UnixNano()
+		last := atomic.LoadInt64(&s.lastDump)
+		if now-last < int64(s.config.DumpInterval) || !atomic.CompareAndSwapInt64(&s.lastDump, last, now) {
+			return
+		}
+
+		buf := make([]byte, s.config.MaxDumpSize)
+		n := runtime.Stack(buf, true)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		dump = string(buf[:n])
+	})
+	return func() string {
+		timer.Stop()
+		mutex.Lock()
+		defer mutex.Unlock()
+		return dump
+	}
+}
+
+func (s *slowRequest) notify(accessLog *AccessLog) {
+	for _, hook := range s.config.Hooks {
+		go func(hook SlowRequestHook) {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.WithField("panic", r).Error("Fail to call slow request hook")
+				}
+			}()
+			hook(accessLog)
+		}(hook)
+	}
+}
+
+// ChannelSlowRequestHook sends slow entries to ch, dropping them while ch is full.
+func ChannelSlowRequestHook(ch chan<- *AccessLog) SlowRequestHook {
+	return func(accessLog *AccessLog) {
+		select {
+		case ch <- accessLog:
+		default:
+		}
+	}
+}
+
+// WebhookSlowRequestHook posts slow entries as JSON to url.
+func WebhookSlowRequestHook(url string) SlowRequestHook {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func(accessLog *AccessLog) {
+		body, err := json.Marshal(accessLog)
+		if err != nil {
+			logrus.WithError(err).Error("Fail to marshal slow request")
+			return
+		}
+		res, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logrus.WithError(err).Error("Fail to post slow request")
+			return
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			logrus.WithError(fmt.Errorf("status %d", res.StatusCode)).Error("Fail to post slow request")
+		}
+	}
+}
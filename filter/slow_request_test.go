@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestAccessLoggerSlowRequest(t *testing.T) {
+	slow := make(chan *AccessLog, 1)
+	config := AccessLoggerConfig{
+		MaxBodySize: 8,
+		SlowRequest: &SlowRequestConfig{
+			Threshold: time.Hour,
+			Routes: []SlowRoute{
+				{Route: "POST /reports/**", Threshold: 20 * time.Millisecond, CaptureBody: true},
+				{Route: "POST /exports/**", Threshold: 20 * time.Millisecond},
+			},
+			Hooks:         []SlowRequestHook{ChannelSlowRequestHook(slow)},
+			GoroutineDump: true,
+		},
+	}
+	register := func(e *echo.Echo) {
+		handler := func(c echo.Context) error {
+			io.ReadAll(c.Request().Body)
+			time.Sleep(50 * time.Millisecond)
+			return c.NoContent(http.StatusOK)
+		}
+		e.POST("/reports/:id", handler)
+		e.POST("/orders/:id", handler)
+		e.POST("/exports/:id", handler)
+	}
+	body := `{"name":"a long enough body"}`
+
+	t.Run("Slow", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/reports/1", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		accessLog, _ := serveAccessLog(t, config, register, req)
+
+		test.Equals(t, true, accessLog.Slow)
+		test.Equals(t, map[string]interface{}{"name": "a long enough body"}, accessLog.Body)
+		test.Assert(t, strings.Contains(accessLog.GoroutineDump, "goroutine "), "expected a goroutine dump")
+
+		select {
+		case hooked := <-slow:
+			test.Equals(t, accessLog, hooked)
+		case <-time.After(time.Second):
+			t.Fatal("expected the hook to be called")
+		}
+	})
+
+	t.Run("DumpInterval", func(t *testing.T) {
+		writer := &recordAccessLogWriter{}
+		config := config
+		config.Writer = writer
+		e := echo.New()
+		e.Use(AccessLoggerWithConfig(config))
+		register(e)
+		for _, path := range []string{"/reports/1", "/exports/1"} {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			e.ServeHTTP(httptest.NewRecorder(), req)
+			<-slow
+		}
+
+		test.Equals(t, 2, writer.len())
+		test.Assert(t, writer.accessLogs[0].GoroutineDump != "", "expected a goroutine dump")
+		test.Equals(t, true, writer.accessLogs[1].Slow)
+		test.Equals(t, "", writer.accessLogs[1].GoroutineDump)
+		test.Equals(t, `{"name":...(truncated)`, writer.accessLogs[1].Body)
+	})
+
+	t.Run("Default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/orders/1", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		accessLog, _ := serveAccessLog(t, config, register, req)
+
+		test.Equals(t, false, accessLog.Slow)
+		test.Equals(t, "", accessLog.GoroutineDump)
+		test.Equals(t, `{"name":...(truncated)`, accessLog.Body)
+	})
+}
@@ -0,0 +1,123 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/jaehue/echo-kit/filter"
+
+const AttributeAPIErrorCode = attribute.Key("api.error.code")
+
+type TraceConfig struct {
+	Skipper middleware.Skipper
+	// TracerProvider default: otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+	// Propagator reads the parent span from the request. Default: W3C traceparent and tracestate
+	Propagator propagation.TextMapPropagator
+}
+
+func Trace() echo.MiddlewareFunc {
+	return TraceWithConfig(TraceConfig{})
+}
+
+// TraceWithConfig starts a server span for every request, as a child of the incoming traceparent if any.
+// The span is named "<controller>.<action>" and is stored in the request context,
+// where AccessLogger reads its trace and span ids.
+func TraceWithConfig(config TraceConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+	if config.Propagator == nil {
+		config.Propagator = propagation.TraceContext{}
+	}
+	tracer := config.TracerProvider.Tracer(tracerName)
+
+	var echoRouter echoRouter
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := config.Propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracer.Start(ctx, spanName(&echoRouter, c),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(c.Path()),
+					semconv.URLPath(req.URL.Path),
+					semconv.ClientAddress(c.RealIP()),
+				),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+
+			// the handler may name itself with c.Set("controller") and c.Set("action")
+			span.SetName(spanName(&echoRouter, c))
+
+			status := responseStatus(c, err)
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+
+			description := http.StatusText(status)
+			var apiError api.Error
+			switch {
+			case errors.As(err, &apiError):
+				span.SetAttributes(AttributeAPIErrorCode.Int(apiError.Code))
+				span.RecordError(err)
+				description = apiError.Error()
+			case err != nil:
+				span.RecordError(err)
+				description = err.Error()
+			}
+			// server spans leave the status unset for 4xx, see the OpenTelemetry HTTP semantic conventions
+			if status >= 500 {
+				span.SetStatus(codes.Error, description)
+			}
+			return err
+		}
+	}
+}
+
+func spanName(er *echoRouter, c echo.Context) string {
+	controller, action := er.getControllerAndAction(c)
+	switch {
+	case controller != "" && action != "":
+		return controller + "." + action
+	case action != "":
+		return action
+	default:
+		return fmt.Sprintf("%s %s", c.Request().Method, c.Path())
+	}
+}
+
+// responseStatus is the status of the response that err will be rendered to,
+// for middlewares running before the error is handled.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		return httpError.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,82 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type traceTestController struct{}
+
+func (*traceTestController) GetOne(c echo.Context) error {
+	return c.NoContent(http.StatusOK)
+}
+
+func (*traceTestController) Delete(c echo.Context) error {
+	return api.RenderFail(c, api.ErrorPermissionDenied.New(nil))
+}
+
+func TestTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	register := func(e *echo.Echo) {
+		e.Use(TraceWithConfig(TraceConfig{TracerProvider: provider}))
+		e.GET("/orders/:id", (&traceTestController{}).GetOne)
+		e.DELETE("/orders/:id", (&traceTestController{}).Delete)
+		e.PUT("/orders/:id", func(c echo.Context) error {
+			return api.RenderFail(c, api.ErrorDB.New(nil))
+		})
+	}
+
+	t.Run("Parent", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		accessLog, _ := serveAccessLog(t, AccessLoggerConfig{}, register, req)
+
+		spans := exporter.GetSpans()
+		test.Equals(t, 1, len(spans))
+		test.Equals(t, "traceTestController.GetOne", spans[0].Name)
+		test.Equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+		test.Equals(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+		test.Equals(t, spans[0].SpanContext.TraceID().String(), accessLog.TraceID)
+		test.Equals(t, spans[0].SpanContext.SpanID().String(), accessLog.SpanID)
+	})
+
+	t.Run("APIError", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodDelete, "/orders/1", nil)
+		serveAccessLog(t, AccessLoggerConfig{}, register, req)
+
+		spans := exporter.GetSpans()
+		test.Equals(t, 1, len(spans))
+		test.Assert(t, !spans[0].Parent.IsValid(), "expected a root span")
+		test.Equals(t, codes.Unset, spans[0].Status.Code)
+		test.Equals(t, 1, len(spans[0].Events))
+
+		attributes := map[string]interface{}{}
+		for _, kv := range spans[0].Attributes {
+			attributes[string(kv.Key)] = kv.Value.AsInterface()
+		}
+		test.Equals(t, int64(10005), attributes["api.error.code"])
+		test.Equals(t, int64(http.StatusForbidden), attributes["http.response.status_code"])
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodPut, "/orders/1", nil)
+		serveAccessLog(t, AccessLoggerConfig{}, register, req)
+
+		spans := exporter.GetSpans()
+		test.Equals(t, 1, len(spans))
+		test.Equals(t, codes.Error, spans[0].Status.Code)
+	})
+}
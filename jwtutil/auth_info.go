@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
+	golangjwt "github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 )
 
@@ -15,23 +16,91 @@ type AuthInfo struct {
 	SessionId string
 	UserId    int64
 	Role      string
+	Scopes    []string
+}
+
+const authInfoContextKey = "authInfo"
+
+// SetAuthInfo stores an identity verified by a non-JWT authenticator (API key, request signature)
+// so that GetAuthInfo and GetVerifiedAuthInfo treat it the same as a verified token.
+func SetAuthInfo(c echo.Context, authInfo AuthInfo) {
+	c.Set(authInfoContextKey, authInfo)
 }
 
 func GetAuthInfo(c echo.Context) (authInfo AuthInfo) {
+	if authInfo, ok := c.Get(authInfoContextKey).(AuthInfo); ok {
+		return authInfo
+	}
+
 	v := c.Get("user")
 	if v == nil {
 		return GetTokenInfo(c.Request().Header.Get(echo.HeaderAuthorization))
 	}
 
-	user := c.Get("user").(*jwt.Token)
-	if user == nil {
-		return
+	authInfo, _ = GetVerifiedAuthInfo(c)
+	return authInfo
+}
+
+// GetVerifiedAuthInfo returns the AuthInfo of the token verified by the JWT middleware.
+// Unlike GetAuthInfo, it never falls back to the unverified Authorization header.
+func GetVerifiedAuthInfo(c echo.Context) (authInfo AuthInfo, ok bool) {
+	if authInfo, ok := c.Get(authInfoContextKey).(AuthInfo); ok {
+		return authInfo, true
 	}
-	claims, ok := user.Claims.(jwt.MapClaims)
-	if !ok {
+
+	switch user := c.Get("user").(type) {
+	case *jwt.Token:
+		if user != nil {
+			return AuthInfoFromToken(user)
+		}
+	case *golangjwt.Token:
+		if user != nil {
+			var claims map[string]interface{}
+			if mapClaims, isMap := user.Claims.(golangjwt.MapClaims); isMap {
+				claims = mapClaims
+			} else if claims, ok = claimsToMap(user.Claims); !ok {
+				return
+			}
+			authInfo, ok = authInfoFromClaims(claims)
+			authInfo.SessionId = user.Signature
+			return
+		}
+	}
+	return
+}
+
+// AuthInfoFromToken reads userId and role from the claims of a verified token.
+// Claims other than jwt.MapClaims are read through their JSON representation.
+func AuthInfoFromToken(token *jwt.Token) (authInfo AuthInfo, ok bool) {
+	var claims map[string]interface{}
+	if mapClaims, isMap := token.Claims.(jwt.MapClaims); isMap {
+		claims = mapClaims
+	} else if claims, ok = claimsToMap(token.Claims); !ok {
 		return
 	}
 
+	authInfo, ok = authInfoFromClaims(claims)
+	authInfo.SessionId = token.Signature
+	return
+}
+
+// claimsToMap reads struct claims through their JSON representation.
+func claimsToMap(claims interface{}) (map[string]interface{}, bool) {
+	var m map[string]interface{}
+	if claims == nil {
+		return m, true
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return nil, false
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, false
+	}
+	return m, true
+}
+
+func authInfoFromClaims(claims map[string]interface{}) (authInfo AuthInfo, ok bool) {
 	userId, ok := claims["userId"]
 	if !ok {
 		return
@@ -44,7 +113,7 @@ func GetAuthInfo(c echo.Context) (authInfo AuthInfo) {
 	}
 
 	if authInfo.UserId == 0 {
-		return
+		return authInfo, false
 	}
 
 	if role, ok := claims["role"]; ok {
@@ -53,7 +122,7 @@ func GetAuthInfo(c echo.Context) (authInfo AuthInfo) {
 		}
 	}
 
-	return authInfo
+	return authInfo, true
 }
 
 func GetTokenInfo(token string) (info AuthInfo) {
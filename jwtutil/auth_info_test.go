@@ -0,0 +1,51 @@
+package jwtutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	golangjwt "github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/pangpanglabs/goutils/test"
+)
+
+type userClaims struct {
+	UserId int64  `json:"userId"`
+	Role   string `json:"role"`
+	jwt.StandardClaims
+}
+
+func newContext(user interface{}) echo.Context {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	if user != nil {
+		c.Set("user", user)
+	}
+	return c
+}
+
+func TestGetVerifiedAuthInfo(t *testing.T) {
+	expected := AuthInfo{SessionId: "sig", UserId: 7, Role: "admin"}
+
+	for name, user := range map[string]interface{}{
+		"map":               &jwt.Token{Claims: jwt.MapClaims{"userId": float64(7), "role": "admin"}, Signature: "sig"},
+		"struct":            &jwt.Token{Claims: &userClaims{UserId: 7, Role: "admin"}, Signature: "sig"},
+		"golang-jwt-map":    &golangjwt.Token{Claims: golangjwt.MapClaims{"userId": float64(7), "role": "admin"}, Signature: "sig"},
+		"golang-jwt-struct": &golangjwt.Token{Claims: &userClaims{UserId: 7, Role: "admin"}, Signature: "sig"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			authInfo, ok := GetVerifiedAuthInfo(newContext(user))
+			test.Equals(t, true, ok)
+			test.Equals(t, expected, authInfo)
+		})
+	}
+
+	t.Run("unverified", func(t *testing.T) {
+		c := newContext(nil)
+		c.Request().Header.Set(echo.HeaderAuthorization, "a.eyJVc2VySWQiOjd9.sig")
+		_, ok := GetVerifiedAuthInfo(c)
+		test.Equals(t, false, ok)
+		test.Equals(t, int64(7), GetAuthInfo(c).UserId)
+	})
+}
@@ -0,0 +1,40 @@
+package jwtutil
+
+import (
+	"fmt"
+
+	"github.com/jaehue/echo-kit/api"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireSelfOrRole allows the request when the verified caller owns the resource
+// (its UserId equals ownerId) or has one of the given roles.
+// Otherwise it returns api.ErrorPermissionDenied, which should be passed to api.RenderFail
+// so that the failure is recorded on the access log entry.
+func RequireSelfOrRole(c echo.Context, ownerId int64, roles ...string) error {
+	authInfo, ok := GetVerifiedAuthInfo(c)
+	if !ok {
+		return api.ErrorPermissionDenied.New(fmt.Errorf("No verified identity for resource of user %d", ownerId))
+	}
+
+	if ownerId != 0 && authInfo.UserId == ownerId {
+		return nil
+	}
+	if HasRole(authInfo, roles...) {
+		return nil
+	}
+
+	return api.ErrorPermissionDenied.New(fmt.Errorf("User %d is not allowed to access resource of user %d", authInfo.UserId, ownerId))
+}
+
+func HasRole(authInfo AuthInfo, roles ...string) bool {
+	if authInfo.Role == "" {
+		return false
+	}
+	for _, role := range roles {
+		if authInfo.Role == role {
+			return true
+		}
+	}
+	return false
+}
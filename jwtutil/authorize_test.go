@@ -0,0 +1,50 @@
+package jwtutil
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jaehue/echo-kit/api"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestRequireSelfOrRole(t *testing.T) {
+	verified := func(authInfo AuthInfo) *AuthInfo { return &authInfo }
+
+	for name, c := range map[string]struct {
+		authInfo *AuthInfo
+		ownerId  int64
+		allowed  bool
+	}{
+		"owner":       {verified(AuthInfo{UserId: 7}), 7, true},
+		"other-user":  {verified(AuthInfo{UserId: 8}), 7, false},
+		"role":        {verified(AuthInfo{UserId: 8, Role: "admin"}), 7, true},
+		"other-role":  {verified(AuthInfo{UserId: 8, Role: "member"}), 7, false},
+		"no-identity": {nil, 7, false},
+		"owner-zero":  {verified(AuthInfo{}), 0, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := newContext(nil)
+			if c.authInfo != nil {
+				SetAuthInfo(ctx, *c.authInfo)
+			}
+
+			err := RequireSelfOrRole(ctx, c.ownerId, "admin")
+			if c.allowed {
+				test.Ok(t, err)
+				return
+			}
+			var apiError api.Error
+			test.Assert(t, errors.As(err, &apiError), "expected an api.Error, got %v", err)
+			test.Equals(t, http.StatusForbidden, apiError.Status())
+		})
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	test.Equals(t, true, HasRole(AuthInfo{Role: "admin"}, "member", "admin"))
+	test.Equals(t, false, HasRole(AuthInfo{Role: "admin"}))
+	test.Equals(t, false, HasRole(AuthInfo{}, ""))
+}
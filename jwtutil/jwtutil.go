@@ -1,7 +1,10 @@
 package jwtutil
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"fmt"
+	"os"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -67,24 +70,108 @@ func ExtractWithSecret(token, jwtSecret string) (jwt.MapClaims, error) {
 		return nil, fmt.Errorf("Required authorization token not found")
 	}
 
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) { return []byte(jwtSecret), nil })
+	parsedToken, err := ParseWithClaims(token, jwt.MapClaims{}, StaticKey([]byte(jwtSecret)))
 	if err != nil {
 		return nil, fmt.Errorf("Error parsing token: %v", err)
 	}
 
-	if jwtSigningMethod != nil && jwtSigningMethod.Alg() != parsedToken.Header["alg"] {
-		return nil, fmt.Errorf("Expected %s signing method but token specified %s",
-			jwtSigningMethod.Alg(),
-			parsedToken.Header["alg"])
+	claimInfo, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claimInfo, nil
+}
+
+// ParseWithClaims parses and verifies token with the key supplied by keyProvider.
+// The token must be signed with an algorithm of the key type, see RequireSigningMethod.
+func ParseWithClaims(token string, claims jwt.Claims, keyProvider KeyProvider) (*jwt.Token, error) {
+	return ParseWithSigningMethod(token, claims, "", keyProvider)
+}
+
+// ParseWithSigningMethod is ParseWithClaims accepting only the tokens signed with alg.
+// An empty alg falls back to the algorithms of the key type.
+func ParseWithSigningMethod(token string, claims jwt.Claims, alg string, keyProvider KeyProvider) (*jwt.Token, error) {
+	parsedToken, err := jwt.ParseWithClaims(token, claims, jwt.Keyfunc(RequireSigningMethod(alg, keyProvider)))
+	if err != nil {
+		return nil, err
 	}
 
 	if !parsedToken.Valid {
 		return nil, fmt.Errorf("Token is invalid")
 	}
+	return parsedToken, nil
+}
 
-	claimInfo, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token")
+// KeyProvider supplies the key used to verify a token.
+type KeyProvider func(token *jwt.Token) (interface{}, error)
+
+// RequireSigningMethod rejects the tokens not signed with alg, e.g. "RS256".
+// With an empty alg, the algorithm must match the type of the key instead:
+// RSA and ECDSA keys accept their algorithms, and HMAC keys the method of SetJwtSigningMethod.
+func RequireSigningMethod(alg string, keyProvider KeyProvider) KeyProvider {
+	return func(token *jwt.Token) (interface{}, error) {
+		if alg != "" && token.Method.Alg() != alg {
+			return nil, fmt.Errorf("Expected %s signing method but token specified %s", alg, token.Header["alg"])
+		}
+
+		key, err := keyProvider(token)
+		if err != nil {
+			return nil, err
+		}
+		if alg == "" {
+			if err := checkKeyType(token, key); err != nil {
+				return nil, err
+			}
+		}
+		return key, nil
+	}
+}
+
+func checkKeyType(token *jwt.Token, key interface{}) error {
+	var expected string
+	switch key.(type) {
+	case []byte:
+		if jwtSigningMethod == nil || token.Method.Alg() == jwtSigningMethod.Alg() {
+			return nil
+		}
+		expected = jwtSigningMethod.Alg()
+	case *rsa.PublicKey:
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return nil
+		}
+		expected = "RSA"
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok {
+			return nil
+		}
+		expected = "ECDSA"
+	default:
+		return nil
+	}
+	return fmt.Errorf("Expected %s signing method but token specified %s", expected, token.Header["alg"])
+}
+
+func StaticKey(key interface{}) KeyProvider {
+	return func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	}
+}
+
+// EnvKey reads the secret from the environment variable name every time a token is verified.
+func EnvKey(name string) KeyProvider {
+	return func(*jwt.Token) (interface{}, error) {
+		secret := os.Getenv(name)
+		if secret == "" {
+			return nil, fmt.Errorf("Environment variable %s is not set", name)
+		}
+		return []byte(secret), nil
+	}
+}
+
+// SecretKey uses the secret configured by SetJwtSecret.
+func SecretKey() KeyProvider {
+	return func(*jwt.Token) (interface{}, error) {
+		return []byte(jwtSecret), nil
 	}
-	return claimInfo, nil
 }
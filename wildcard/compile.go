@@ -0,0 +1,524 @@
+package wildcard
+
+import (
+	"fmt"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Matcher is a compiled pattern. It is safe for concurrent use.
+//
+// Pattern syntax:
+//
+//	pattern  matches
+//	*        any sequence (not crossing the separator in path mode)
+//	**       any sequence, including separators
+//	?        any single character (not the separator in path mode)
+//	[a-z]    character class, negated by [!a-z] or [^a-z]
+//	{a,b}    alternation
+//	\x       the literal character x
+//
+// Matching runs an NFA simulation, so it is linear in len(name) for any pattern.
+type Matcher struct {
+	pattern string
+	prog    *program
+}
+
+type options struct {
+	caseInsensitive bool
+	separator       rune
+}
+
+type Option func(*options)
+
+// CaseInsensitive matches letters regardless of case.
+func CaseInsensitive() Option {
+	return func(o *options) { o.caseInsensitive = true }
+}
+
+// PathSeparator enables path mode: "*" and "?" do not match sep, while "**" does.
+// In path mode "/**/" also matches "/", and a trailing "/**" also matches the parent itself.
+func PathSeparator(sep rune) Option {
+	return func(o *options) { o.separator = sep }
+}
+
+func Compile(pattern string, opts ...Option) (*Matcher, error) {
+	set, err := CompileSet([]string{pattern}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{pattern: pattern, prog: set.prog}, nil
+}
+
+func MustCompile(pattern string, opts ...Option) *Matcher {
+	m, err := Compile(pattern, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m *Matcher) Match(name string) bool {
+	return m.prog.run(name, true) >= 0
+}
+
+func (m *Matcher) String() string {
+	return m.pattern
+}
+
+// Set matches a name against many patterns in a single pass.
+type Set struct {
+	patterns []string
+	prog     *program
+}
+
+func CompileSet(patterns []string, opts ...Option) (*Set, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &compiler{options: o}
+	c.prog.caseInsensitive = o.caseInsensitive
+	c.prog.separator = o.separator
+	// the program starts with a chain of splits, one branch per pattern
+	var splits []int
+	for i := 0; i < len(patterns)-1; i++ {
+		split := c.emit(inst{op: opSplit})
+		c.prog.insts[split].y = split + 1
+		splits = append(splits, split)
+	}
+	for i, pattern := range patterns {
+		if i < len(splits) {
+			c.prog.insts[splits[i]].x = c.pc()
+		} else if i > 0 {
+			c.prog.insts[splits[i-1]].y = c.pc()
+		}
+
+		nodes, err := parse(pattern, o)
+		if err != nil {
+			return nil, err
+		}
+		c.compile(nodes)
+		c.emit(inst{op: opMatch, index: i})
+	}
+	if len(patterns) == 0 {
+		c.emit(inst{op: opFail})
+	}
+
+	return &Set{patterns: patterns, prog: &c.prog}, nil
+}
+
+func MustCompileSet(patterns []string, opts ...Option) *Set {
+	s, err := CompileSet(patterns, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// MatchAny reports whether name matches at least one pattern of the set.
+func (s *Set) MatchAny(name string) bool {
+	return s.prog.run(name, true) >= 0
+}
+
+// MatchIndex returns the index of the first pattern matching name, or -1.
+func (s *Set) MatchIndex(name string) int {
+	return s.prog.run(name, false)
+}
+
+func (s *Set) Len() int {
+	return len(s.patterns)
+}
+
+// parse
+
+type nodeKind int
+
+const (
+	nodeRune nodeKind = iota
+	nodeAny
+	nodeStar
+	nodeDoubleStar
+	nodeClass
+	nodeAlternation
+	nodeOptional
+)
+
+type node struct {
+	kind         nodeKind
+	r            rune
+	class        *charClass
+	alternatives [][]node
+}
+
+type charClass struct {
+	negated bool
+	ranges  []rune // pairs of lo, hi
+}
+
+type parser struct {
+	pattern string
+	pos     int
+	options options
+}
+
+func parse(pattern string, o options) ([]node, error) {
+	p := &parser{pattern: pattern, options: o}
+	nodes, err := p.sequence(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.pattern) {
+		return nil, p.errorf("unexpected %q", p.pattern[p.pos])
+	}
+	return nodes, nil
+}
+
+func (p *parser) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("wildcard: invalid pattern %q at %d: %s", p.pattern, p.pos, fmt.Sprintf(format, v...))
+}
+
+func (p *parser) next() rune {
+	r, n := utf8.DecodeRuneInString(p.pattern[p.pos:])
+	p.pos += n
+	return r
+}
+
+func (p *parser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.pattern[p.pos:])
+	return r
+}
+
+func (p *parser) sequence(inAlternation bool) ([]node, error) {
+	var nodes []node
+	for p.pos < len(p.pattern) {
+		r := p.peek()
+		if inAlternation && (r == ',' || r == '}') {
+			break
+		}
+		p.next()
+		switch r {
+		case '*':
+			if p.pos < len(p.pattern) && p.peek() == '*' {
+				p.next()
+				for p.pos < len(p.pattern) && p.peek() == '*' {
+					p.next()
+				}
+				nodes = append(nodes, node{kind: nodeDoubleStar})
+			} else {
+				nodes = append(nodes, node{kind: nodeStar})
+			}
+		case '?':
+			nodes = append(nodes, node{kind: nodeAny})
+		case '[':
+			class, err := p.class()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node{kind: nodeClass, class: class})
+		case '{':
+			n, err := p.alternation()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		case '\\':
+			if p.pos >= len(p.pattern) {
+				return nil, p.errorf("trailing \\")
+			}
+			nodes = append(nodes, node{kind: nodeRune, r: p.next()})
+		default:
+			nodes = append(nodes, node{kind: nodeRune, r: r})
+		}
+	}
+	return p.globstar(nodes), nil
+}
+
+func (p *parser) alternation() (node, error) {
+	n := node{kind: nodeAlternation}
+	for {
+		alternative, err := p.sequence(true)
+		if err != nil {
+			return n, err
+		}
+		n.alternatives = append(n.alternatives, alternative)
+		if p.pos >= len(p.pattern) {
+			return n, p.errorf("missing }")
+		}
+		if p.next() == '}' {
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) class() (*charClass, error) {
+	class := &charClass{}
+	if r := p.peek(); p.pos < len(p.pattern) && (r == '!' || r == '^') {
+		p.next()
+		class.negated = true
+	}
+	first := true
+	for {
+		if p.pos >= len(p.pattern) {
+			return nil, p.errorf("missing ]")
+		}
+		r := p.next()
+		if r == ']' && !first {
+			break
+		}
+		first = false
+		if r == '\\' {
+			if p.pos >= len(p.pattern) {
+				return nil, p.errorf("trailing \\")
+			}
+			r = p.next()
+		}
+		hi := r
+		if p.pos+1 < len(p.pattern) && p.peek() == '-' && p.pattern[p.pos+1] != ']' {
+			p.next()
+			hi = p.next()
+			if hi == '\\' {
+				if p.pos >= len(p.pattern) {
+					return nil, p.errorf("trailing \\")
+				}
+				hi = p.next()
+			}
+			if hi < r {
+				return nil, p.errorf("invalid range %c-%c", r, hi)
+			}
+		}
+		class.ranges = append(class.ranges, r, hi)
+	}
+	return class, nil
+}
+
+// globstar rewrites "**/" into an optional "(**/)" and a trailing "/**" into an optional "(/**)".
+func (p *parser) globstar(nodes []node) []node {
+	sep := p.options.separator
+	if sep == 0 {
+		return nodes
+	}
+	isSep := func(n node) bool { return n.kind == nodeRune && n.r == sep }
+
+	var result []node
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		switch {
+		case n.kind == nodeDoubleStar && i+1 < len(nodes) && isSep(nodes[i+1]):
+			result = append(result, node{kind: nodeOptional, alternatives: [][]node{{n, nodes[i+1]}}})
+			i++
+		case isSep(n) && i+2 == len(nodes) && nodes[i+1].kind == nodeDoubleStar:
+			result = append(result, node{kind: nodeOptional, alternatives: [][]node{{n, nodes[i+1]}}})
+			i++
+		default:
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// compile
+
+type opcode uint8
+
+const (
+	opRune   opcode = iota
+	opAny           // any rune except the separator
+	opAnyAll        // any rune
+	opClass
+	opSplit
+	opJmp
+	opMatch
+	opFail
+)
+
+type inst struct {
+	op    opcode
+	r     rune
+	class *charClass
+	x, y  int
+	index int
+}
+
+type program struct {
+	insts           []inst
+	caseInsensitive bool
+	separator       rune
+	pool            sync.Pool // of *[2]*threadList
+}
+
+type compiler struct {
+	prog    program
+	options options
+}
+
+func (c *compiler) emit(i inst) int {
+	c.prog.insts = append(c.prog.insts, i)
+	return len(c.prog.insts) - 1
+}
+
+func (c *compiler) pc() int {
+	return len(c.prog.insts)
+}
+
+func (c *compiler) compile(nodes []node) {
+	for _, n := range nodes {
+		switch n.kind {
+		case nodeRune:
+			r := n.r
+			if c.options.caseInsensitive {
+				r = unicode.ToLower(r)
+			}
+			c.emit(inst{op: opRune, r: r})
+		case nodeAny:
+			c.emit(inst{op: opAny})
+		case nodeClass:
+			c.emit(inst{op: opClass, class: n.class})
+		case nodeStar, nodeDoubleStar:
+			op := opAny
+			if n.kind == nodeDoubleStar {
+				op = opAnyAll
+			}
+			// L1: split L2, L3; L2: any; jmp L1; L3:
+			split := c.emit(inst{op: opSplit})
+			c.prog.insts[split].x = c.emit(inst{op: op})
+			c.emit(inst{op: opJmp, x: split})
+			c.prog.insts[split].y = c.pc()
+		case nodeOptional:
+			split := c.emit(inst{op: opSplit})
+			c.prog.insts[split].x = c.pc()
+			c.compile(n.alternatives[0])
+			c.prog.insts[split].y = c.pc()
+		case nodeAlternation:
+			var jmps []int
+			for i, alternative := range n.alternatives {
+				if i < len(n.alternatives)-1 {
+					split := c.emit(inst{op: opSplit})
+					c.prog.insts[split].x = c.pc()
+					c.compile(alternative)
+					jmps = append(jmps, c.emit(inst{op: opJmp}))
+					c.prog.insts[split].y = c.pc()
+				} else {
+					c.compile(alternative)
+				}
+			}
+			for _, jmp := range jmps {
+				c.prog.insts[jmp].x = c.pc()
+			}
+		}
+	}
+}
+
+// run
+
+type threadList struct {
+	sparse []int
+	dense  []int
+}
+
+func newThreadList(n int) *threadList {
+	return &threadList{sparse: make([]int, n), dense: make([]int, 0, n)}
+}
+
+func (l *threadList) contains(pc int) bool {
+	i := l.sparse[pc]
+	return i < len(l.dense) && l.dense[i] == pc
+}
+
+func (l *threadList) add(pc int) {
+	l.sparse[pc] = len(l.dense)
+	l.dense = append(l.dense, pc)
+}
+
+func (l *threadList) clear() {
+	l.dense = l.dense[:0]
+}
+
+func (p *program) addThread(l *threadList, pc int) {
+	if l.contains(pc) {
+		return
+	}
+	l.add(pc)
+	switch p.insts[pc].op {
+	case opJmp:
+		p.addThread(l, p.insts[pc].x)
+	case opSplit:
+		p.addThread(l, p.insts[pc].x)
+		p.addThread(l, p.insts[pc].y)
+	}
+}
+
+// run returns the smallest index of a matching pattern, or -1.
+// With any set, it returns as soon as the result can no longer be -1.
+func (p *program) run(name string, any bool) int {
+	lists, ok := p.pool.Get().(*[2]*threadList)
+	if !ok {
+		lists = &[2]*threadList{newThreadList(len(p.insts)), newThreadList(len(p.insts))}
+	}
+	defer p.pool.Put(lists)
+
+	current, next := lists[0], lists[1]
+	current.clear()
+	next.clear()
+	p.addThread(current, 0)
+
+	for _, r := range name {
+		if len(current.dense) == 0 {
+			return -1
+		}
+		if p.caseInsensitive {
+			r = unicode.ToLower(r)
+		}
+		for _, pc := range current.dense {
+			i := &p.insts[pc]
+			var ok bool
+			switch i.op {
+			case opRune:
+				ok = i.r == r
+			case opAny:
+				ok = p.separator == 0 || r != p.separator
+			case opAnyAll:
+				ok = true
+			case opClass:
+				ok = i.class.match(r, p.caseInsensitive) && (p.separator == 0 || r != p.separator)
+			}
+			if ok {
+				p.addThread(next, pc+1)
+			}
+		}
+		current, next = next, current
+		next.clear()
+	}
+
+	result := -1
+	for _, pc := range current.dense {
+		if i := p.insts[pc]; i.op == opMatch {
+			if any {
+				return i.index
+			}
+			if result == -1 || i.index < result {
+				result = i.index
+			}
+		}
+	}
+	return result
+}
+
+func (c *charClass) match(r rune, caseInsensitive bool) bool {
+	in := c.contains(r)
+	if !in && caseInsensitive {
+		in = c.contains(unicode.ToUpper(r))
+	}
+	return in != c.negated
+}
+
+func (c *charClass) contains(r rune) bool {
+	for i := 0; i < len(c.ranges); i += 2 {
+		if c.ranges[i] <= r && r <= c.ranges[i+1] {
+			return true
+		}
+	}
+	return false
+}
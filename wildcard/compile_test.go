@@ -0,0 +1,63 @@
+package wildcard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pangpanglabs/goutils/test"
+)
+
+func TestCompile(t *testing.T) {
+	for _, c := range []struct {
+		pattern, name string
+		opts          []Option
+		expected      bool
+	}{
+		{"", "", nil, true},
+		{"abc", "abc", nil, true},
+		{"a*c", "a/b/c", nil, true},
+		{"a?c", "abc", nil, true},
+		{"[a-c]x", "bx", nil, true},
+		{"[!a-c]x", "bx", nil, false},
+		{"*.{jpg,png}", "logo.png", nil, true},
+		{"*.{jpg,png}", "logo.gif", nil, false},
+		{`\*x`, "*x", nil, true},
+		{`\*x`, "ax", nil, false},
+		{"ABC*", "abcdef", []Option{CaseInsensitive()}, true},
+		{"[A-C]x", "bX", []Option{CaseInsensitive()}, true},
+		{"/public/*", "/public/a", []Option{PathSeparator('/')}, true},
+		{"/public/*", "/public/a/b", []Option{PathSeparator('/')}, false},
+		{"/public/**", "/public/a/b", []Option{PathSeparator('/')}, true},
+		{"/public/**", "/public", []Option{PathSeparator('/')}, true},
+		{"/hooks/**/callback", "/hooks/callback", []Option{PathSeparator('/')}, true},
+		{"/hooks/**/callback", "/hooks/a/b/callback", []Option{PathSeparator('/')}, true},
+	} {
+		m, err := Compile(c.pattern, c.opts...)
+		test.Ok(t, err)
+		test.Assert(t, m.Match(c.name) == c.expected, "%q match %q: expected %v", c.pattern, c.name, c.expected)
+	}
+
+	for _, invalid := range []string{"[a-", "{a,b", `a\`, "[z-a]"} {
+		_, err := Compile(invalid)
+		test.Assert(t, err != nil, "expected error for %q", invalid)
+	}
+}
+
+func TestCompileLinear(t *testing.T) {
+	pattern := strings.Repeat("a*", 30) + "b"
+	name := strings.Repeat("a", 1000)
+
+	test.Equals(t, false, MustCompile(pattern).Match(name))
+	test.Equals(t, false, Match(pattern, name))
+}
+
+func TestSet(t *testing.T) {
+	set := MustCompileSet([]string{"/users/*", "/users/**", "/health"}, PathSeparator('/'))
+
+	test.Equals(t, 0, set.MatchIndex("/users/1"))
+	test.Equals(t, 1, set.MatchIndex("/users/1/orders"))
+	test.Equals(t, 2, set.MatchIndex("/health"))
+	test.Equals(t, -1, set.MatchIndex("/orders"))
+	test.Equals(t, true, set.MatchAny("/users/1/orders"))
+	test.Equals(t, false, MustCompileSet(nil).MatchAny(""))
+}
@@ -1,7 +1,12 @@
 package wildcard
 
+import "unicode/utf8"
+
 // github.com/minio/minio/pkg/wildcard 참고
 
+// Match reports whether name matches pattern, where "*" matches any sequence and "?" any single character.
+// Unlike Compile, "[", "{" and "\" are literal characters here, so a pattern
+// containing them must be escaped before it is compiled instead.
 func Match(pattern, name string) (matched bool) {
 	if pattern == "" {
 		return name == pattern
@@ -10,26 +15,48 @@ func Match(pattern, name string) (matched bool) {
 		return true
 	}
 
-	return deepMatchRune([]rune(name), []rune(pattern))
+	return matchGreedy(name, pattern)
 }
 
-func deepMatchRune(str, pattern []rune) bool {
-	for len(pattern) > 0 {
-		switch pattern[0] {
-		default:
-			if len(str) == 0 || str[0] != pattern[0] {
-				return false
-			}
-		case '?':
-			if len(str) == 0 {
-				return false
+// matchGreedy backtracks only to the most recent "*", which keeps matching linear in practice
+// and quadratic in the worst case instead of exponential.
+func matchGreedy(str, pattern string) bool {
+	var (
+		s, p         int
+		starP, starS = -1, 0
+	)
+	for s < len(str) {
+		if p < len(pattern) {
+			pr, pn := utf8.DecodeRuneInString(pattern[p:])
+			switch pr {
+			case '*':
+				starP, starS = p, s
+				p += pn
+				continue
+			case '?':
+				_, sn := utf8.DecodeRuneInString(str[s:])
+				s += sn
+				p += pn
+				continue
+			default:
+				sr, sn := utf8.DecodeRuneInString(str[s:])
+				if sr == pr {
+					s += sn
+					p += pn
+					continue
+				}
 			}
-		case '*':
-			return deepMatchRune(str, pattern[1:]) ||
-				(len(str) > 0 && deepMatchRune(str[1:], pattern))
 		}
-		str = str[1:]
-		pattern = pattern[1:]
+		if starP == -1 {
+			return false
+		}
+		_, sn := utf8.DecodeRuneInString(str[starS:])
+		starS += sn
+		s = starS
+		p = starP + 1
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
 	}
-	return len(str) == 0 && len(pattern) == 0
+	return p == len(pattern)
 }